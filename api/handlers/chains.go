@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/cyrildever/treee/common/http_errors"
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/model/response"
+	routing "github.com/qiangxue/fasthttp-routing"
+)
+
+const defaultPageSize = 100
+
+// GetChains ...
+func GetChains(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetChains", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	cursor := string(request.QueryArgs().Peek("cursor"))
+	limit := defaultPageSize
+	if request.QueryArgs().Has("limit") {
+		if limit, err = request.QueryArgs().GetUint("limit"); err != nil || limit == 0 {
+			log.Info("Wrong limit", "error", err)
+			return http_errors.SetInvalidParam(request, requestID, "invalid limit")
+		}
+	}
+	order := string(request.QueryArgs().Peek("sort"))
+
+	chains, next, err := index.Current.Chains(order, cursor, limit)
+	if err != nil {
+		log.Info("Wrong sort or cursor", "error", err)
+		return http_errors.SetInvalidParam(request, requestID, err.Error())
+	}
+	res := response.Page{
+		Items: chains,
+		Next:  next,
+	}
+
+	return sendResponse("GetChains", request, requestID, res, nil)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/cyrildever/treee/common/http_errors"
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/model"
+	routing "github.com/qiangxue/fasthttp-routing"
+	"github.com/valyala/fasthttp"
+)
+
+// GetItem ...
+func GetItem(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetItem", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	if data.Current == nil {
+		log.Warn("No data configured")
+		return http_errors.SetUnavailableError(request, requestID)
+	}
+	id := model.Hash(string(request.QueryArgs().Peek("id")))
+	if id.IsEmpty() {
+		log.Info("Empty query string")
+		return http_errors.SetInvalidParam(request, requestID, "missing the leaf id")
+	}
+
+	section, err := index.Current.ItemReader(id, data.Current)
+	if err != nil {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+
+	request.Response.Header.Set("Content-Type", "application/octet-stream")
+	request.Response.Header.Set("Accept-Ranges", "bytes")
+	size := int(section.Size())
+	if byteRange := request.Request.Header.Peek("Range"); len(byteRange) > 0 {
+		start, end, err := fasthttp.ParseByteRange(byteRange, size)
+		if err != nil {
+			request.Response.Header.Set("Content-Range", "bytes */"+strconv.Itoa(size))
+			request.Response.SetStatusCode(fasthttp.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+		request.Response.Header.SetContentRange(start, end, size)
+		request.Response.SetStatusCode(fasthttp.StatusPartialContent)
+		request.Response.SetBodyStream(io.NewSectionReader(section, int64(start), int64(end-start+1)), end-start+1)
+		return nil
+	}
+	request.Response.SetStatusCode(fasthttp.StatusOK)
+	request.Response.SetBodyStream(section, size)
+	return nil
+}
+
+// GetLineItems ...
+func GetLineItems(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetLineItems", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	if data.Current == nil {
+		log.Warn("No data configured")
+		return http_errors.SetUnavailableError(request, requestID)
+	}
+	id := model.Hash(string(request.QueryArgs().Peek("id")))
+	if id.IsEmpty() {
+		log.Info("Empty query string")
+		return http_errors.SetInvalidParam(request, requestID, "missing the leaf id")
+	}
+
+	line, err := index.Current.Line(id)
+	if err != nil || len(line) == 0 {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+	readers := make([]io.Reader, len(line))
+	size := int64(0)
+	for i, leaf := range line {
+		section, err := index.LeafReader(leaf, data.Current)
+		if err != nil {
+			log.Error("Unable to access segment", "error", err, "segment", leaf.Segment)
+			return http_errors.SetInternalError(request, requestID)
+		}
+		readers[i] = section
+		size += leaf.Size
+	}
+
+	request.Response.Header.Set("Content-Type", "application/octet-stream")
+	request.Response.SetStatusCode(fasthttp.StatusOK)
+	request.Response.SetBodyStream(io.MultiReader(readers...), int(size))
+	return nil
+}
@@ -34,6 +34,8 @@ func GetLeaf(request *routing.Context) error {
 		}
 	})
 	takeLast := request.QueryArgs().GetBool("takeLast")
+	// The proofs of non-membership are sent along with a 404 unless `proof=false` is passed
+	withProof := !request.QueryArgs().Has("proof") || request.QueryArgs().GetBool("proof")
 
 	if len(ids) == 0 {
 		log.Info("Empty query string")
@@ -82,6 +84,23 @@ func GetLeaf(request *routing.Context) error {
 	}
 
 	if len(res) == 0 {
+		if withProof {
+			var proofs []index.AbsenceProof
+			for _, id := range ids {
+				proof, err := index.Current.ProveAbsent(id)
+				if err != nil {
+					log.Info("Unable to prove absence", "id", id, "error", err)
+					res := response.ProofError{
+						Code:  response.GetCodeFromError(err),
+						ID:    string(id),
+						Error: err.Error(),
+					}
+					return sendResponse("GetLeaf", request, requestID, res, nil, res.Code)
+				}
+				proofs = append(proofs, *proof)
+			}
+			return sendResponse("GetLeaf", request, requestID, proofs, nil, 404)
+		}
 		return http_errors.SetNotFoundError(request, requestID)
 	}
 
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cyrildever/treee/api"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/model/response"
+	routing "github.com/qiangxue/fasthttp-routing"
+	"github.com/valyala/fasthttp"
+	"gotest.tools/assert"
+)
+
+// TestGetLeaf ...
+func TestGetLeaf(t *testing.T) {
+	treee, _ := index.New(13)
+	for i := 1; i <= 20; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	index.Current = treee
+	router := routing.New()
+	api.Routes(router)
+
+	status, body := get(router, "/api/leaf?ids="+fmt.Sprintf("%064x", 5))
+	assert.Equal(t, status, 200)
+	var leaves []branch.Leaf
+	assert.NilError(t, json.Unmarshal(body, &leaves))
+	assert.Equal(t, leaves[0].Position, int64(50))
+
+	// Proofs of non-membership by default
+	missing := []model.Hash{model.Hash(fmt.Sprintf("%064x", 21)), model.Hash(fmt.Sprintf("%064x", 42))}
+	status, body = get(router, "/api/leaf?ids="+string(missing[0])+"&ids="+string(missing[1]))
+	assert.Equal(t, status, 404)
+	var proofs []index.AbsenceProof
+	assert.NilError(t, json.Unmarshal(body, &proofs))
+	assert.Equal(t, len(proofs), 2)
+	status, body = get(router, "/api/root")
+	assert.Equal(t, status, 200)
+	var root response.Root
+	assert.NilError(t, json.Unmarshal(body, &root))
+	for i, proof := range proofs {
+		assert.NilError(t, index.VerifyAbsence(missing[i], treee.InitPrime, root.Root, proof))
+	}
+	assert.Assert(t, index.VerifyAbsence(model.Hash(fmt.Sprintf("%064x", 5)), treee.InitPrime, root.Root, proofs[0]) != nil)
+
+	status, body = get(router, "/api/leaf?proof=false&ids="+string(missing[0]))
+	assert.Equal(t, status, 404)
+	assert.Equal(t, len(body), 0)
+}
+
+func get(router *routing.Router, uri string) (int, []byte) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	ctx.Request.SetRequestURI(uri)
+	router.HandleRequest(&ctx)
+	return ctx.Response.StatusCode(), ctx.Response.Body()
+}
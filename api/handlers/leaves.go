@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/cyrildever/treee/common/http_errors"
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model/response"
+	routing "github.com/qiangxue/fasthttp-routing"
+)
+
+// GetLeaves ...
+func GetLeaves(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetLeaves", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	cursor := string(request.QueryArgs().Peek("cursor"))
+	limit := defaultPageSize
+	if request.QueryArgs().Has("limit") {
+		if limit, err = request.QueryArgs().GetUint("limit"); err != nil || limit == 0 {
+			log.Info("Wrong limit", "error", err)
+			return http_errors.SetInvalidParam(request, requestID, "invalid limit")
+		}
+	}
+
+	found, next, err := index.Current.Scan(cursor, limit)
+	if err != nil {
+		log.Info("Unable to scan the index", "error", err)
+		return http_errors.SetInvalidParam(request, requestID, err.Error())
+	}
+	leaves := make([]branch.Leaf, len(found))
+	for i, leaf := range found {
+		leaves[i] = *leaf
+	}
+	res := response.Page{
+		Items: leaves,
+		Next:  next,
+	}
+
+	return sendResponse("GetLeaves", request, requestID, res, nil)
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"github.com/cyrildever/treee/common/http_errors"
 	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/exception"
 	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
 	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/model/response"
 	routing "github.com/qiangxue/fasthttp-routing"
 )
 
@@ -18,31 +21,120 @@ func GetLine(request *routing.Context) error {
 	}
 	defer cancel()
 
-	var id model.Hash
+	var id, after model.Hash
 	request.QueryArgs().VisitAll(func(key, value []byte) {
 		if string(key) == "id" {
 			id = model.Hash(string(value))
+		} else if string(key) == "after" {
+			after = model.Hash(string(value))
 		}
 	})
+	withDigest := request.QueryArgs().GetBool("digest")
+	full := request.QueryArgs().GetBool("full")
+	reverse := request.QueryArgs().GetBool("reverse")
+	limit := 0
+	if request.QueryArgs().Has("limit") {
+		if limit, err = request.QueryArgs().GetUint("limit"); err != nil {
+			log.Info("Wrong limit", "error", err)
+			return http_errors.SetInvalidParam(request, requestID, "invalid limit")
+		}
+	}
+	paginated := full || reverse || request.QueryArgs().Has("limit") || request.QueryArgs().Has("after")
 
 	if id.IsEmpty() {
 		log.Info("Empty query string")
 		return http_errors.SetInvalidParam(request, requestID, "missing the leaf id")
 	}
 
-	line, err := index.Current.Line(id)
+	if request.QueryArgs().GetBool("count") {
+		return getChainInfo(request, requestID, id)
+	}
+	if request.QueryArgs().Has("nth") {
+		n, err := request.QueryArgs().GetUint("nth")
+		if err != nil {
+			log.Info("Wrong sequence number", "error", err)
+			return http_errors.SetInvalidParam(request, requestID, "invalid nth")
+		}
+		leaf, err := index.Current.Nth(id, n)
+		if err != nil {
+			return http_errors.SetNotFoundError(request, requestID)
+		}
+		return sendResponse("GetLine", request, requestID, *leaf, nil)
+	}
+
+	var line []*branch.Leaf
+	var next model.Hash
+	if paginated {
+		line, next, err = index.Current.LinePage(id, after, limit, reverse)
+		if _, ok := err.(*exception.NotFoundError); ok {
+			return http_errors.SetNotFoundError(request, requestID)
+		}
+	} else {
+		line, err = index.Current.Line(id)
+	}
 	if err != nil {
 		log.Error("Impossible to find a line", "error", err)
 		return http_errors.SetInternalError(request, requestID)
 	}
-	res := make([]string, len(line))
-	for i, leaf := range line {
-		idStr, _ := leaf.ID.String()
-		res[i] = idStr
-	}
-	if len(res) == 0 {
+	if len(line) == 0 && !paginated {
 		return http_errors.SetNotFoundError(request, requestID)
 	}
 
+	var res interface{}
+	if full {
+		leaves := make([]branch.Leaf, len(line))
+		for i, leaf := range line {
+			leaves[i] = *leaf
+		}
+		res = leaves
+	} else if withDigest {
+		items := make([]response.LineItem, len(line))
+		for i, leaf := range line {
+			idStr, _ := leaf.ID.String()
+			digestStr, _ := leaf.Digest.String()
+			items[i] = response.LineItem{
+				ID:     idStr,
+				Digest: digestStr,
+			}
+		}
+		res = items
+	} else {
+		ids := make([]string, len(line))
+		for i, leaf := range line {
+			idStr, _ := leaf.ID.String()
+			ids[i] = idStr
+		}
+		res = ids
+	}
+
+	if paginated {
+		nextStr, _ := next.String()
+		res = response.Page{
+			Items: res,
+			Next:  nextStr,
+		}
+	}
+	return sendResponse("GetLine", request, requestID, res, nil)
+}
+
+func getChainInfo(request *routing.Context, requestID string, id model.Hash) error {
+	found, err := index.Current.Search(id)
+	if err != nil {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+	length, err := index.Current.ChainLength(id)
+	if err != nil {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+	idx, err := index.Current.IndexInChain(id)
+	if err != nil {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+	originStr, _ := found.Origin.String()
+	res := response.ChainInfo{
+		Origin: originStr,
+		Length: length,
+		Index:  idx,
+	}
 	return sendResponse("GetLine", request, requestID, res, nil)
 }
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"github.com/cyrildever/treee/common/http_errors"
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/model/response"
+	routing "github.com/qiangxue/fasthttp-routing"
+)
+
+// GetNextLeaf ...
+func GetNextLeaf(request *routing.Context) error {
+	return getNeighbour(request, "GetNextLeaf", index.Current.Next)
+}
+
+// GetPrevLeaf ...
+func GetPrevLeaf(request *routing.Context) error {
+	return getNeighbour(request, "GetPrevLeaf", index.Current.Prev)
+}
+
+// GetRelation ...
+func GetRelation(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetRelation", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	a := model.Hash(string(request.QueryArgs().Peek("a")))
+	b := model.Hash(string(request.QueryArgs().Peek("b")))
+	if a.IsEmpty() || b.IsEmpty() {
+		log.Info("Empty query string")
+		return http_errors.SetInvalidParam(request, requestID, "missing the leaf ids")
+	}
+
+	sameChain, err := index.Current.SameChain(a, b)
+	if err != nil {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+	res := response.Relation{
+		SameChain: sameChain,
+	}
+	if sameChain {
+		distance, err := index.Current.Distance(a, b)
+		if err != nil {
+			log.Error("Impossible to compute distance", "error", err)
+			return http_errors.SetInternalError(request, requestID)
+		}
+		res.Distance = distance
+		if distance >= 0 {
+			res.First, _ = a.String()
+		} else {
+			res.First, _ = b.String()
+		}
+	}
+
+	return sendResponse("GetRelation", request, requestID, res, nil)
+}
+
+func getNeighbour(request *routing.Context, context string, neighbour func(model.Hash) (*branch.Leaf, error)) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", context, requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	id := model.Hash(string(request.QueryArgs().Peek("id")))
+	if id.IsEmpty() {
+		log.Info("Empty query string")
+		return http_errors.SetInvalidParam(request, requestID, "missing the leaf id")
+	}
+
+	leaf, err := neighbour(id)
+	if err != nil || leaf == nil {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+
+	return sendResponse(context, request, requestID, *leaf, nil)
+}
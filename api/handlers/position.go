@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"github.com/cyrildever/treee/common/http_errors"
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
+	routing "github.com/qiangxue/fasthttp-routing"
+)
+
+// GetPosition ...
+func GetPosition(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetPosition", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	args := request.QueryArgs()
+	segment := 0
+	if args.Has("segment") {
+		if segment, err = args.GetUint("segment"); err != nil {
+			log.Info("Wrong segment", "error", err)
+			return http_errors.SetInvalidParam(request, requestID, "invalid segment")
+		}
+	}
+	if args.Has("offset") {
+		offset, err := args.GetUint("offset")
+		if err != nil {
+			log.Info("Wrong offset", "error", err)
+			return http_errors.SetInvalidParam(request, requestID, "invalid offset")
+		}
+		leaf, err := index.Current.AtPosition(segment, int64(offset))
+		if err != nil {
+			return http_errors.SetNotFoundError(request, requestID)
+		}
+		return sendResponse("GetPosition", request, requestID, *leaf, nil)
+	}
+
+	from, err := args.GetUint("from")
+	if err != nil {
+		log.Info("Wrong range", "error", err)
+		return http_errors.SetInvalidParam(request, requestID, "missing or invalid offset or range")
+	}
+	to, err := args.GetUint("to")
+	if err != nil || to < from {
+		log.Info("Wrong range", "error", err)
+		return http_errors.SetInvalidParam(request, requestID, "missing or invalid offset or range")
+	}
+	found := index.Current.PositionRange(segment, int64(from), int64(to))
+	if len(found) == 0 {
+		return http_errors.SetNotFoundError(request, requestID)
+	}
+	res := make([]branch.Leaf, len(found))
+	for i, leaf := range found {
+		res[i] = *leaf
+	}
+
+	return sendResponse("GetPosition", request, requestID, res, nil)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/cyrildever/treee/common/http_errors"
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/model/response"
+	routing "github.com/qiangxue/fasthttp-routing"
+)
+
+// GetRoot ...
+func GetRoot(request *routing.Context) error {
+	_, cancel, requestID, err := createContext()
+	log := logger.InitHandler("handlers", "GetRoot", requestID)
+	if err != nil {
+		log.Error("Creating context error", "error", err)
+		return http_errors.SetInternalError(request, requestID)
+	}
+	defer cancel()
+
+	res := response.Root{
+		Root: index.Current.RootHash(),
+		Size: index.Current.Size(),
+	}
+	return sendResponse("GetRoot", request, requestID, res, nil)
+}
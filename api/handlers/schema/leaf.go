@@ -37,12 +37,24 @@ var Leaf string = `{
         "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
       ]
     },
+    "segment": {
+      "$id": "#/properties/segment",
+      "type": "integer",
+      "title": "The segment schema",
+      "description": "The number of the segment file the item is stored in, if the data rotates into several files.",
+      "default": 0,
+      "minimum": 0,
+      "examples": [
+        0
+      ]
+    },
     "position": {
       "$id": "#/properties/position",
       "type": "integer",
       "title": "The position schema",
       "description": "An explanation about the purpose of this instance.",
       "default": 0,
+      "minimum": 0,
       "examples": [
         0
       ]
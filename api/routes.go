@@ -9,8 +9,17 @@ import (
 func Routes(router *routing.Router) {
 	apiRouter := router.Group("/api")
 	apiRouter.Options("*", setCorsHeader)
+	(*apiRouter).Get("/chains", setCorsHeader, handlers.GetChains)
+	(*apiRouter).Get("/item", setCorsHeader, handlers.GetItem)
 	(*apiRouter).Get("/leaf", setCorsHeader, handlers.GetLeaf)
+	(*apiRouter).Get("/leaf/next", setCorsHeader, handlers.GetNextLeaf)
+	(*apiRouter).Get("/leaf/prev", setCorsHeader, handlers.GetPrevLeaf)
+	(*apiRouter).Get("/leaf/relation", setCorsHeader, handlers.GetRelation)
+	(*apiRouter).Get("/leaves", setCorsHeader, handlers.GetLeaves)
 	(*apiRouter).Get("/line", handlers.GetLine)
+	(*apiRouter).Get("/line/items", setCorsHeader, handlers.GetLineItems)
+	(*apiRouter).Get("/position", setCorsHeader, handlers.GetPosition)
+	(*apiRouter).Get("/root", setCorsHeader, handlers.GetRoot)
 	(*apiRouter).Post("/leaf", setCorsHeader, handlers.PostLeaf)
 	(*apiRouter).Delete("/leaf", setCorsHeader, handlers.DeleteLeaf)
 }
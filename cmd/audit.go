@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/data"
+)
+
+// Audit re-hashes every item in the data file and prints those whose ID doesn't match, exiting with `1` if any was found
+func Audit(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to an existing index")
+	dataPath := fs.String("data", conf.DataPath, "File path to the immutable data file, or pattern of its segment files")
+	algorithm := fs.String("hash", conf.HashAlgorithm, "Hash algorithm used for the IDs of the items: sha256, sha512 or blake2b")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of items hashed in parallel")
+	_ = fs.Parse(args)
+
+	hasher, err := data.NewHasher(*algorithm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	treee, err := loadIndex(*indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load index: %s\n", err)
+		return 2
+	}
+	source, err := data.OpenSource(*dataPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open data: %s\n", err)
+		return 2
+	}
+	defer source.Close()
+
+	mismatches := treee.Audit(source, hasher, *workers)
+	bytes, _ := json.MarshalIndent(mismatches, "", "  ")
+	fmt.Println(string(bytes))
+	if len(mismatches) > 0 {
+		return 1
+	}
+	return 0
+}
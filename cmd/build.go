@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
+)
+
+// Build creates a new saved index from scratch by decoding all the records of the data file, or of all its segment files,
+// exiting with `1` if some records couldn't be indexed
+func Build(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to the index to create")
+	dataPath := fs.String("data", conf.DataPath, "File path to the immutable data file, or pattern of its segment files")
+	decoderName := fs.String("decoder", data.NDJSON, "Format of the records in the data file: "+strings.Join(data.Decoders(), ", "))
+	algorithm := fs.String("hash", conf.HashAlgorithm, "Hash algorithm used for the IDs of the items: sha256, sha512 or blake2b")
+	initPrime := fs.Uint64("init", conf.InitPrime, "Initial prime number to use for the index")
+	compression := fs.String("compress", conf.Compression, "Compression of the index file: gzip, zstd or none")
+	force := fs.Bool("force", false, "Overwrite the index file if it already exists")
+	_ = fs.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = "saved" + string(os.PathSeparator) + "treee.json"
+	}
+	if _, err := os.Stat(*indexPath); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "index file already exists: %s (use -force to overwrite it)\n", *indexPath)
+		return 2
+	}
+	hasher, err := data.NewHasher(*algorithm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, err := data.NewDecoder(*decoderName, strings.NewReader(""), 0, hasher); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	treee, err := index.New(*initPrime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to instantiate new index: %s\n", err)
+		return 2
+	}
+	if err = treee.UseCompression(*compression); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	failures := 0
+	for segment := 0; segment == 0 || data.IsPattern(*dataPath); segment++ {
+		path := data.SegmentPath(*dataPath, segment)
+		if _, err := os.Stat(path); segment > 0 && os.IsNotExist(err) {
+			break
+		}
+		n, err := buildSegment(treee, path, segment, *decoderName, hasher)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		failures += n
+	}
+
+	if _, err = treee.SaveAs(*indexPath); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to save index: %s\n", err)
+		return 2
+	}
+	fmt.Printf("%d items indexed in %s\n", treee.Size(), *indexPath)
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// buildSegment adds to the index all the records of the passed segment file, returning the number of records that couldn't be indexed
+func buildSegment(treee *index.Treee, path string, segment int, decoderName string, hasher data.Hasher) (failures int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open data file: %w", err)
+	}
+	defer file.Close()
+	decoder, err := data.NewFinalDecoder(decoderName, file, 0, hasher)
+	if err != nil {
+		return
+	}
+	for {
+		record, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return failures, fmt.Errorf("unable to decode record at offset %d of %s: %w", decoder.Offset(), path, err)
+		}
+		err = treee.Add(branch.Leaf{
+			ID:       record.ID,
+			Segment:  segment,
+			Position: record.Position,
+			Size:     record.Size,
+			Previous: record.Previous,
+		})
+		if err != nil {
+			if _, ok := err.(*exception.AlreadyExistsInIndexError); !ok {
+				failures++
+			}
+			fmt.Fprintf(os.Stderr, "unable to index record at position %d of %s: %s\n", record.Position, path, err)
+		}
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > decoder.Offset() {
+		fmt.Fprintf(os.Stderr, "ignoring incomplete record at offset %d of %s\n", decoder.Offset(), path)
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Command is a one-shot tool run from the command line instead of the micro-service, eg. `$ ./treee layout-check -file saved/treee.json`;
+// it returns the exit code of the process
+type Command func(args []string) int
+
+var commands = map[string]Command{
+	"audit":        Audit,
+	"build":        Build,
+	"compact":      Compact,
+	"layout-check": LayoutCheck,
+	"pages":        Pages,
+	"rekey":        Rekey,
+	"restore":      Restore,
+	"sign":         Sign,
+}
+
+//--- FUNCTIONS
+
+// Run executes the passed command with its arguments
+func Run(name string, args []string) int {
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", name)
+		usage()
+		return 2
+	}
+	return command(args)
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "Available commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/utils"
+)
+
+// Compact rewrites the data file with only the items of the index, then switches over the data file and the index together;
+// both the server and the writer must be stopped beforehand
+func Compact(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to an existing index")
+	dataPath := fs.String("data", conf.DataPath, "File path to the immutable data file")
+	order := fs.String("order", index.FILE_ORDER, "Order of the items in the compacted file: file or chain")
+	decoderName := fs.String("decoder", conf.RecordDecoder, "Format of the records to write the items in: "+strings.Join(data.Decoders(), " or ")+", or none to write the items as is")
+	mapPath := fs.String("map", "", "File path to write the old-to-new position map to as JSON (default to the data file path with a .map.json suffix)")
+	_ = fs.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = "saved" + string(os.PathSeparator) + "treee.json"
+	}
+	if data.IsPattern(*dataPath) {
+		fmt.Fprintln(os.Stderr, "unable to compact segmented data: compact each segment file into a single data file first")
+		return 2
+	}
+	var encoder data.RecordEncoder
+	if *decoderName != "none" {
+		e, err := data.NewEncoder(*decoderName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		encoder = e
+	}
+	if *mapPath == "" {
+		*mapPath = *dataPath + ".map.json"
+	}
+	if done, err := index.FinishCompaction(*indexPath, *dataPath); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to finish previous compaction: %s\n", err)
+		return 2
+	} else if done {
+		fmt.Fprintln(os.Stderr, "previous compaction finished")
+	}
+
+	treee, err := loadIndex(*indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load index: %s\n", err)
+		return 2
+	}
+	source, err := data.OpenSource(*dataPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open data file: %s\n", err)
+		return 2
+	}
+	defer source.Close()
+
+	// 1- Compacted data
+	pendingData := *dataPath + index.PENDING_SUFFIX
+	relocations, size, err := compactTo(treee, source, pendingData, *order, encoder)
+	if err != nil {
+		_ = os.Remove(pendingData)
+		fmt.Fprintf(os.Stderr, "unable to compact data file: %s\n", err)
+		return 2
+	}
+	if err = treee.Relocate(relocations); err != nil {
+		_ = os.Remove(pendingData)
+		fmt.Fprintf(os.Stderr, "unable to relocate items: %s\n", err)
+		return 2
+	}
+	bytes, _ := json.Marshal(relocations)
+	if err = utils.WriteFileAtomically(*mapPath, bytes); err != nil {
+		_ = os.Remove(pendingData)
+		fmt.Fprintf(os.Stderr, "unable to write position map: %s\n", err)
+		return 2
+	}
+
+	// 2- Offset of the follower, now at the end of the compacted file
+	offsetPath := *indexPath + ".offset"
+	if _, err := os.Stat(offsetPath); err == nil {
+		if err = utils.WriteFileAtomically(offsetPath+index.PENDING_SUFFIX, []byte(fmt.Sprint(size))); err != nil {
+			_, _ = index.FinishCompaction(*indexPath, *dataPath) // Discards the pending files
+			fmt.Fprintf(os.Stderr, "unable to write follower offset: %s\n", err)
+			return 2
+		}
+	}
+
+	// 3- Relocated index, the commit point of the compaction
+	if _, err = treee.SaveAs(*indexPath + index.PENDING_SUFFIX); err != nil {
+		_, _ = index.FinishCompaction(*indexPath, *dataPath)
+		fmt.Fprintf(os.Stderr, "unable to save index: %s\n", err)
+		return 2
+	}
+	if _, err = index.FinishCompaction(*indexPath, *dataPath); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to switch over, run the command again to finish it: %s\n", err)
+		return 2
+	}
+	fmt.Printf("%d items compacted into %d bytes, position map written to %s\n", len(relocations), size, *mapPath)
+	return 0
+}
+
+// compactTo writes the compacted data to the passed path and syncs it, returning the relocations and the size of the file
+func compactTo(treee *index.Treee, source data.Source, path, order string, encoder data.RecordEncoder) (relocations []index.Relocation, size int64, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	relocations, err = treee.Compact(source, w, order, encoder)
+	if err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	size = info.Size()
+	return
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"os"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/index"
+)
+
+// LoadKey returns the key encrypting the saved index, read from the `ENCRYPTION_KEY` environment variable or else from the key file,
+// or `nil` if none is configured
+func LoadKey(conf *config.Config) ([]byte, error) {
+	if conf.Key != "" {
+		return index.ParseKey([]byte(conf.Key))
+	}
+	return readKeyFile(conf.KeyFile)
+}
+
+// LoadSigningKey returns the ed25519 private key signing the saved index, or `nil` if none is configured
+func LoadSigningKey(conf *config.Config) (ed25519.PrivateKey, error) {
+	if conf.SigningKeyFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(conf.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return index.ParsePrivateKey(content)
+}
+
+// LoadTrustedKeys returns the ed25519 public keys trusted to sign the index to load, or `nil` if none is configured
+func LoadTrustedKeys(conf *config.Config) ([]ed25519.PublicKey, error) {
+	if conf.TrustedKeys == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(conf.TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+	return index.ParsePublicKeys(content)
+}
+
+// loadIndex loads the saved index at the passed path, decrypting it with the configured key if need be and verifying its signature
+// against the configured trusted keys, if any
+func loadIndex(path string) (*index.Treee, error) {
+	conf, _ := config.GetConfig()
+	key, err := LoadKey(conf)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := LoadTrustedKeys(conf)
+	if err != nil {
+		return nil, err
+	}
+	return index.LoadVerified(path, key, trusted)
+}
+
+// readKeyFile returns the key in the passed file, or `nil` if the path is empty
+func readKeyFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return index.ParseKey(content)
+}
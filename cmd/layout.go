@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cyrildever/treee/config"
+)
+
+// LayoutCheck reports the overlaps and gaps between items in the data file, exiting with `1` if any overlap was found
+func LayoutCheck(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("layout-check", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to an existing index")
+	_ = fs.Parse(args)
+
+	treee, err := loadIndex(*indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load index: %s\n", err)
+		return 2
+	}
+	report := treee.CheckLayout()
+	bytes, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(bytes))
+	if report.IsCorrupted() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cyrildever/treee/config"
+)
+
+// Pages writes a saved index to a page file to be served as a disk-backed index
+func Pages(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("pages", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to an existing index")
+	pagesPath := fs.String("pages", conf.PagesPath, "File path to the page file to create")
+	force := fs.Bool("force", false, "Overwrite the page file if it already exists")
+	_ = fs.Parse(args)
+
+	if *pagesPath == "" {
+		fmt.Fprintln(os.Stderr, "missing path to the page file")
+		return 2
+	}
+	if _, err := os.Stat(*pagesPath); err == nil {
+		if !*force {
+			fmt.Fprintf(os.Stderr, "page file already exists: %s (use -force to overwrite it)\n", *pagesPath)
+			return 2
+		}
+		if err = os.Remove(*pagesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to remove page file: %s\n", err)
+			return 2
+		}
+	}
+	treee, err := loadIndex(*indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load index: %s\n", err)
+		return 2
+	}
+	if err = treee.SavePages(*pagesPath); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write page file: %s\n", err)
+		return 2
+	}
+	fmt.Printf("%d items written to %s\n", treee.Size(), *pagesPath)
+	return 0
+}
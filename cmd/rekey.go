@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/index"
+)
+
+// Rekey re-encrypts a saved index with a new key, or decrypts it if no new key is passed; the server must be stopped beforehand
+func Rekey(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to an existing index")
+	keyFile := fs.String("key", "", "File path to the current key, if the index is encrypted (default to the configured key)")
+	newKeyFile := fs.String("new-key", "", "File path to the new key (the index gets decrypted if empty)")
+	generate := fs.Bool("generate", false, "Generate the new key and write it to the -new-key file, which must not exist")
+	_ = fs.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = "saved" + string(os.PathSeparator) + "treee.json"
+	}
+	key, err := LoadKey(conf)
+	if *keyFile != "" {
+		key, err = readKeyFile(*keyFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read current key: %s\n", err)
+		return 2
+	}
+	var newKey []byte
+	if *generate {
+		if *newKeyFile == "" {
+			fmt.Fprintln(os.Stderr, "missing path to the new key file")
+			return 2
+		}
+		if newKey, err = index.GenerateKey(); err == nil {
+			err = writeNewFile(*newKeyFile, []byte(hex.EncodeToString(newKey)+"\n"))
+		}
+	} else {
+		newKey, err = readKeyFile(*newKeyFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to get new key: %s\n", err)
+		return 2
+	}
+
+	trusted, err := LoadTrustedKeys(conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read trusted keys: %s\n", err)
+		return 2
+	}
+	treee, err := index.LoadVerified(*indexPath, key, trusted)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load index: %s\n", err)
+		return 2
+	}
+	signingKey, err := LoadSigningKey(conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read signing key: %s\n", err)
+		return 2
+	}
+	if signingKey != nil {
+		treee.UseSigning(signingKey)
+	}
+	if err = treee.UseEncryption(newKey); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid new key: %s\n", err)
+		return 2
+	}
+	if _, err = treee.SaveAs(*indexPath); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to save index: %s\n", err)
+		return 2
+	}
+	if newKey == nil {
+		fmt.Printf("%s decrypted\n", *indexPath)
+	} else {
+		fmt.Printf("%s encrypted with the key in %s\n", *indexPath, *newKeyFile)
+	}
+	return 0
+}
+
+// writeNewFile writes the passed content to a file only readable by its owner, failing if it already exists
+func writeNewFile(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/index"
+)
+
+// Restore points the index file at the latest snapshot generation saved before the passed time, or lists the generations;
+// the server must be stopped beforehand
+func Restore(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to the index to restore")
+	dir := fs.String("dir", conf.SnapshotDir, "Directory of the snapshot generations")
+	at := fs.String("at", "", "Time to restore the index at, in RFC 3339 format or as a duration ago, eg. 2h30m (default to the latest generation)")
+	list := fs.Bool("list", false, "Print the manifest of the generations as JSON instead of restoring one")
+	_ = fs.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = "saved" + string(os.PathSeparator) + "treee.json"
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "missing directory of the snapshot generations")
+		return 2
+	}
+	if *list {
+		all, err := index.Generations(*dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read manifest: %s\n", err)
+			return 2
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(all)
+		return 0
+	}
+
+	when, err := parseTime(*at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid time: %s\n", err)
+		return 2
+	}
+	gen, err := index.RestoreGeneration(*dir, when, *indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to restore index: %s\n", err)
+		return 2
+	}
+	fmt.Printf("%s restored from %s saved at %s (%d items)\n", *indexPath, gen.File, gen.Time.Format(time.RFC3339), gen.Leaves)
+	if gen.Offset != "" {
+		fmt.Printf("the follower of the data file resumes from %s\n", gen.Offset)
+	}
+	return 0
+}
+
+// parseTime reads the passed time in RFC 3339 format or as a duration before now, an empty string meaning now
+func parseTime(str string) (time.Time, error) {
+	if str == "" {
+		return time.Now(), nil
+	}
+	if d, err := time.ParseDuration(str); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
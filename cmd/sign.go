@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/index"
+)
+
+// Sign writes the ed25519 signature of a saved index next to it, eg. to sign an index saved before signing was configured,
+// and optionally generates the signing key pair first
+func Sign(args []string) int {
+	conf, _ := config.GetConfig()
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	indexPath := fs.String("file", conf.IndexPath, "File path to an existing index")
+	keyFile := fs.String("key", conf.SigningKeyFile, "File path to the ed25519 private key")
+	generate := fs.Bool("generate", false, "Generate the key pair and write it to the -key file and its .pub sibling, which must not exist")
+	_ = fs.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = "saved" + string(os.PathSeparator) + "treee.json"
+	}
+	if *keyFile == "" {
+		fmt.Fprintln(os.Stderr, "missing path to the signing key file")
+		return 2
+	}
+	if *generate {
+		public, private, err := index.GenerateSigningKey()
+		if err == nil {
+			err = writeNewFile(*keyFile, []byte(hex.EncodeToString(private.Seed())+"\n"))
+		}
+		if err == nil {
+			err = writeNewFile(*keyFile+".pub", []byte(hex.EncodeToString(public)+"\n"))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to generate signing key: %s\n", err)
+			return 2
+		}
+		fmt.Printf("public key written to %s.pub\n", *keyFile)
+	}
+
+	content, err := os.ReadFile(*keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read signing key: %s\n", err)
+		return 2
+	}
+	key, err := index.ParsePrivateKey(content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid signing key: %s\n", err)
+		return 2
+	}
+	if err = index.SignFile(*indexPath, key); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to sign index: %s\n", err)
+		return 2
+	}
+	fmt.Printf("%s signed in %s%s\n", *indexPath, *indexPath, index.SIGNATURE_SUFFIX)
+	return 0
+}
@@ -50,6 +50,13 @@ func SetNotFoundError(request *routing.Context, requestID string) error {
 	return nil
 }
 
+// SetUnavailableError ...
+func SetUnavailableError(request *routing.Context, requestID string) error {
+	request.Response.Header.Set("X-Request-ID", requestID)
+	request.Response.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	return nil
+}
+
 // SetRPCError ...
 func SetRPCError(err error, request *routing.Context, requestID string) error {
 	errorStatus, _ := status.FromError(err)
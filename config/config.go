@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/cyrildever/treee/common/logger"
 )
@@ -17,7 +18,40 @@ type Config struct {
 	Host           string
 	InitPrime      uint64
 	IndexPath      string
+	Compression    string
+	SnapshotDir    string
+	KeepLast       int
+	KeepHourly     int
+	KeepDaily      int
+	SnapshotEvery  time.Duration
+	Deltas         int
+	KeyFile        string
+	Key            string
+	SigningKeyFile string
+	TrustedKeys    string
+	Unverified     string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3Prefix       string
+	S3AccessKey    string
+	S3SecretKey    string
+	BackupInterval time.Duration
+	PagesPath      string
+	CacheSize      int
+	Store          string
+	StorePath      string
+	DataPath       string
+	HashAlgorithm  string
+	VerifyContent  bool
+	Follow         bool
+	RecordDecoder  string
+	PollInterval   time.Duration
+	CommitInterval time.Duration
 	UsePersistence bool
+	UseChaining    bool
+	StrictLayout   bool
+	FilterRate     float64
 }
 
 var singleton *Config
@@ -37,7 +71,42 @@ func (c *Config) populateWithEnv() {
 	setString("HOST", &c.Host)
 	setUintOrPanic("INIT_PRIME", &c.InitPrime)
 	setString("INDEX_PATH", &c.IndexPath)
+	setString("COMPRESSION", &c.Compression)
+	setString("SNAPSHOT_DIR", &c.SnapshotDir)
+	setInt("KEEP_SNAPSHOTS", &c.KeepLast)
+	setInt("KEEP_HOURLY", &c.KeepHourly)
+	setInt("KEEP_DAILY", &c.KeepDaily)
+	setDuration("SNAPSHOT_INTERVAL", &c.SnapshotEvery)
+	setInt("DELTA_SNAPSHOTS", &c.Deltas)
+	setString("ENCRYPTION_KEY_FILE", &c.KeyFile)
+	setString("ENCRYPTION_KEY", &c.Key)
+	setString("SIGNING_KEY_FILE", &c.SigningKeyFile)
+	setString("TRUSTED_KEYS_FILE", &c.TrustedKeys)
+	setString("UNVERIFIED_INDEX", &c.Unverified)
+	setString("S3_ENDPOINT", &c.S3Endpoint)
+	setString("S3_REGION", &c.S3Region)
+	setString("S3_BUCKET", &c.S3Bucket)
+	setString("S3_PREFIX", &c.S3Prefix)
+	setString("AWS_ACCESS_KEY_ID", &c.S3AccessKey)
+	setString("S3_ACCESS_KEY_ID", &c.S3AccessKey)
+	setString("AWS_SECRET_ACCESS_KEY", &c.S3SecretKey)
+	setString("S3_SECRET_ACCESS_KEY", &c.S3SecretKey)
+	setDuration("BACKUP_INTERVAL", &c.BackupInterval)
+	setString("PAGES_PATH", &c.PagesPath)
+	setInt("PAGE_CACHE", &c.CacheSize)
+	setString("STORE", &c.Store)
+	setString("STORE_PATH", &c.StorePath)
+	setString("DATA_PATH", &c.DataPath)
+	setString("HASH_ALGORITHM", &c.HashAlgorithm)
+	setBoolean("VERIFY_CONTENT", &c.VerifyContent)
+	setBoolean("FOLLOW_DATA", &c.Follow)
+	setString("RECORD_DECODER", &c.RecordDecoder)
+	setDuration("POLL_INTERVAL", &c.PollInterval)
+	setDuration("COMMIT_INTERVAL", &c.CommitInterval)
 	setBoolean("PERMANENT_INDEX", &c.UsePersistence)
+	setBoolean("HASH_CHAINING", &c.UseChaining)
+	setBoolean("STRICT_LAYOUT", &c.StrictLayout)
+	setFloat("FILTER_RATE", &c.FilterRate)
 }
 
 //--- FUNCTIONS
@@ -55,14 +124,71 @@ func GetConfig() (*Config, error) {
 		httpPort := flag.String("t.port", "7000", "HTTP port number")
 		host := flag.String("t.host", "0.0.0.0", "Host address")
 		indexPath := flag.String("t.file", "", "File path to an existing index")
+		keyFile := flag.String("t.key", "", "File path to the key encrypting the saved index")
+		signingKeyFile := flag.String("t.sign", "", "File path to the ed25519 private key signing the saved index")
+		trustedKeys := flag.String("t.trusted", "", "File path to the ed25519 public keys trusted to sign the index to load, one per line")
+		unverified := flag.String("t.unverified", "refuse", "What to do when the signature of the index can't be verified: refuse to start or start readonly")
+		compression := flag.String("t.compress", "", "Compression of the saved index: gzip, zstd or none (default to the one of the loaded file)")
+		snapshotDir := flag.String("t.snapshots", "", "Directory to save each snapshot of the index to as a new timestamped generation, the index file pointing at the latest one")
+		keepLast := flag.Int("t.keep", 10, "Number of most recent snapshot generations to keep")
+		keepHourly := flag.Int("t.hourly", 0, "Number of past hours to keep the latest snapshot generation of")
+		keepDaily := flag.Int("t.daily", 0, "Number of past days to keep the latest snapshot generation of")
+		snapshotEvery := flag.Duration("t.every", time.Minute, "Minimum interval between two snapshot generations, the saves in between only replacing the index file")
+		deltas := flag.Int("t.deltas", 0, "Number of delta snapshots of the changed items saved between two full snapshots of the index (0 to disable)")
+		s3Endpoint := flag.String("t.s3", "", "Endpoint of the S3-compatible object store to back the index file up to, eg. http://localhost:9000")
+		s3Region := flag.String("t.region", "us-east-1", "Region of the S3-compatible object store")
+		s3Bucket := flag.String("t.bucket", "", "Bucket to back the index file up to")
+		s3Prefix := flag.String("t.prefix", "", "Prefix of the backup objects in the bucket, eg. treee/")
+		backupInterval := flag.Duration("t.backup", time.Hour, "Interval between two backups of the index file to the bucket")
+		pagesPath := flag.String("t.pages", "", "File path to the page file of a disk-backed index, used instead of the index file if set")
+		cacheSize := flag.Int("t.cache", 100000, "Maximum number of nodes and leaves of a disk-backed index to keep in memory")
+		storeKind := flag.String("t.store", "", "Store the index is mirrored to and rebuilt from instead of the index file: bolt or memory")
+		storePath := flag.String("t.db", "", "File path to the bolt store (default saved/treee.db)")
+		dataPath := flag.String("t.data", "", "File path to the immutable data file")
+		hashAlgorithm := flag.String("t.hash", "sha256", "Hash algorithm used for the IDs of the items: sha256, sha512 or blake2b")
+		verifyContent := flag.Bool("t.verify", false, "Check that the ID of an item is the hash of its content in the data file upon insertion")
+		follow := flag.Bool("t.follow", false, "Tail the data file and index the records appended to it")
+		recordDecoder := flag.String("t.decoder", "ndjson", "Format of the records in the followed data file: ndjson or length-prefixed")
+		pollInterval := flag.Duration("t.poll", time.Second, "Interval between two checks of the followed data file")
+		commitInterval := flag.Duration("t.commit", 10*time.Second, "Minimum interval between two saves of the index by the follower of the data file")
 		initPrime := flag.String("t.init", "0", "Initial prime number to use for the index")
 		usePersistence := flag.Bool("t.persist", true, "Activate persistence")
+		useChaining := flag.Bool("t.chain", false, "Activate hash chaining of subchain items")
+		strictLayout := flag.Bool("t.strict", false, "Reject items overlapping existing ones in the file")
+		filterRate := flag.Float64("t.filter", 0, "False-positive rate of the Bloom filter short-circuiting lookups of unknown IDs, eg. 0.01 (0 to disable)")
 
 		flag.Parse()
 
 		singleton.HTTPPort = *httpPort
 		singleton.Host = *host
 		singleton.IndexPath = *indexPath
+		singleton.Compression = *compression
+		singleton.SnapshotDir = *snapshotDir
+		singleton.KeepLast = *keepLast
+		singleton.KeepHourly = *keepHourly
+		singleton.KeepDaily = *keepDaily
+		singleton.SnapshotEvery = *snapshotEvery
+		singleton.Deltas = *deltas
+		singleton.KeyFile = *keyFile
+		singleton.SigningKeyFile = *signingKeyFile
+		singleton.TrustedKeys = *trustedKeys
+		singleton.Unverified = *unverified
+		singleton.S3Endpoint = *s3Endpoint
+		singleton.S3Region = *s3Region
+		singleton.S3Bucket = *s3Bucket
+		singleton.S3Prefix = *s3Prefix
+		singleton.BackupInterval = *backupInterval
+		singleton.PagesPath = *pagesPath
+		singleton.CacheSize = *cacheSize
+		singleton.Store = *storeKind
+		singleton.StorePath = *storePath
+		singleton.DataPath = *dataPath
+		singleton.HashAlgorithm = *hashAlgorithm
+		singleton.VerifyContent = *verifyContent
+		singleton.Follow = *follow
+		singleton.RecordDecoder = *recordDecoder
+		singleton.PollInterval = *pollInterval
+		singleton.CommitInterval = *commitInterval
 		if *initPrime != "0" {
 			p, e := strconv.ParseUint(*initPrime, 10, 64)
 			if e != nil {
@@ -72,6 +198,9 @@ func GetConfig() (*Config, error) {
 			singleton.InitPrime = p
 		}
 		singleton.UsePersistence = *usePersistence
+		singleton.UseChaining = *useChaining
+		singleton.StrictLayout = *strictLayout
+		singleton.FilterRate = *filterRate
 
 		singleton.populateWithEnv()
 	})
@@ -85,6 +214,27 @@ func setBoolean(envName string, shouldChange *bool) {
 	}
 }
 
+func setDuration(envName string, shouldChange *time.Duration) {
+	str := os.Getenv(envName)
+	if d, err := time.ParseDuration(str); err == nil {
+		*shouldChange = d
+	}
+}
+
+func setFloat(envName string, shouldChange *float64) {
+	str := os.Getenv(envName)
+	if f, err := strconv.ParseFloat(str, 64); err == nil {
+		*shouldChange = f
+	}
+}
+
+func setInt(envName string, shouldChange *int) {
+	str := os.Getenv(envName)
+	if i, err := strconv.Atoi(str); err == nil {
+		*shouldChange = i
+	}
+}
+
 func setString(envName string, shouldChange *string) {
 	str := os.Getenv(envName)
 	if str != "" {
@@ -0,0 +1,324 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/utils"
+	"github.com/cyrildever/treee/utils/s3"
+)
+
+// MAX_SIGNATURE_ATTEMPTS is the number of times the file to upload and its signature are read for them to match before giving up on the latter
+const MAX_SIGNATURE_ATTEMPTS = 5
+
+//--- TYPES
+
+// Backup pushes the saved index file to an S3-compatible bucket as timestamped objects named like the snapshot generations
+// (see `index.GenerationFile()`), along with its signature and delta snapshots if any, and restores it from there
+type Backup struct {
+	client    *s3.Client
+	prefix    string
+	retention index.Retention
+
+	mu   sync.Mutex
+	last state
+	stop chan struct{}
+	done chan struct{}
+}
+
+// state tells whether the saved index file changed since the last push
+type state struct {
+	size   int64
+	time   time.Time
+	deltas int
+}
+
+//--- METHODS
+
+// List returns the backups in the bucket, from the oldest to the most recent, the number of items they hold being unknown
+func (b *Backup) List() ([]index.Generation, error) {
+	objects, err := b.client.List(b.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var all []index.Generation
+	for _, object := range objects {
+		if at, ok := index.GenerationTime(object.Key); ok {
+			all = append(all, index.Generation{File: object.Key, Time: at, Bytes: object.Size})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time.Before(all[j].Time)
+	})
+	return all, nil
+}
+
+// Push uploads the saved index file at the passed path as a new backup, then deletes the backups the retention policy doesn't keep
+func (b *Backup) Push(path string) (*index.Generation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.push(path)
+}
+
+// Restore downloads the most recent backup to the passed path, along with its signature and delta snapshots if any, each file being
+// replaced atomically and only if the download matches the checksum it was uploaded with; it returns a `NoGenerationError` if the bucket
+// holds no backup
+func (b *Backup) Restore(path string) (*index.Generation, error) {
+	all, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, exception.NewNoGenerationError(time.Now().UTC().Format(time.RFC3339))
+	}
+	latest := all[len(all)-1]
+	if err = b.download(latest.File, path); err != nil {
+		return nil, err
+	}
+	err = b.download(latest.File+index.SIGNATURE_SUFFIX, path+index.SIGNATURE_SUFFIX)
+	if e, ok := err.(*s3.Error); ok && e.StatusCode == 404 {
+		err = os.Remove(path + index.SIGNATURE_SUFFIX)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Any delta left next to the file belongs to another snapshot
+	for _, deltaPath := range index.DeltaPaths(path) {
+		_ = os.Remove(deltaPath)
+		_ = os.Remove(deltaPath + index.SIGNATURE_SUFFIX)
+	}
+	objects, err := b.client.List(latest.File + index.DELTA_SUFFIX)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		if err = b.download(object.Key, path+strings.TrimPrefix(object.Key, latest.File)); err != nil {
+			return nil, err
+		}
+	}
+	return &latest, nil
+}
+
+// Start pushes the saved index file at the passed path at the passed interval in the background until `Stop()` is called,
+// unless it doesn't exist yet or neither it nor its deltas changed since the last push
+func (b *Backup) Start(path string, interval time.Duration) {
+	log := logger.Init("backup", "Start")
+
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+			b.mu.Lock()
+			current, err := stateOf(path)
+			if os.IsNotExist(err) || (err == nil && current == b.last) {
+				b.mu.Unlock()
+				continue
+			}
+			gen, err := b.push(path)
+			b.mu.Unlock()
+			if err != nil {
+				log.Error("Unable to back up index", "error", err)
+			} else {
+				log.Info("Index backed up", "key", gen.File, "bytes", gen.Bytes)
+			}
+		}
+	}()
+}
+
+// Stop waits for the current push to end and stops backing up the index
+func (b *Backup) Stop() {
+	if b.stop != nil {
+		close(b.stop)
+		<-b.done
+		b.stop = nil
+	}
+}
+
+func (b *Backup) download(key, path string) error {
+	body, err := b.client.Get(key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return utils.WriteAtomically(path, func(w io.Writer) error {
+		_, err := io.Copy(w, body)
+		return err
+	})
+}
+
+// push must be called with the lock held
+func (b *Backup) push(path string) (*index.Generation, error) {
+	file, signature, err := openSigned(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// The file may be replaced by a save in the meantime, the opened one being the one uploaded with its signature, and the deltas
+	// of the new one then uploaded along with it are ignored when loading it
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	deltaPaths := index.DeltaPaths(path)
+
+	all, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if len(all) > 0 && !now.After(all[len(all)-1].Time) {
+		now = all[len(all)-1].Time.Add(time.Nanosecond)
+	}
+	gen := index.Generation{
+		File:  b.prefix + index.GenerationFile(now),
+		Time:  now,
+		Bytes: info.Size(),
+	}
+	// The deltas are uploaded first for a backup to be listed only once complete
+	for _, deltaPath := range deltaPaths {
+		if err = b.uploadFile(deltaPath, gen.File+strings.TrimPrefix(deltaPath, path)); err != nil {
+			return nil, err
+		}
+	}
+	if err = b.upload(file, signature, gen.File); err != nil {
+		return nil, err
+	}
+	b.last = state{size: info.Size(), time: info.ModTime(), deltas: len(deltaPaths)}
+
+	kept := make(map[string]bool)
+	for _, k := range b.retention.Keep(append(all, gen)) {
+		kept[k.File] = true
+	}
+	for _, old := range all {
+		if !kept[old.File] {
+			if err = b.client.Delete(old.File); err != nil {
+				return nil, err
+			}
+			_ = b.client.Delete(old.File + index.SIGNATURE_SUFFIX)
+			deltas, _ := b.client.List(old.File + index.DELTA_SUFFIX)
+			for _, object := range deltas {
+				_ = b.client.Delete(object.Key)
+			}
+		}
+	}
+	return &gen, nil
+}
+
+// upload puts the passed file under the passed key, then its passed signature, if any, next to it
+func (b *Backup) upload(file *os.File, signature []byte, key string) error {
+	if err := b.client.Put(key, file); err != nil {
+		return err
+	}
+	if signature == nil {
+		return nil
+	}
+	return b.client.Put(key+index.SIGNATURE_SUFFIX, bytes.NewReader(signature))
+}
+
+// uploadFile puts the file at the passed path, along with its signature if any, under the passed key, unless it doesn't exist
+func (b *Backup) uploadFile(path, key string) error {
+	file, signature, err := openSigned(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return b.upload(file, signature, key)
+}
+
+//--- FUNCTIONS
+
+// openSigned opens the file at the passed path and reads its signature, if any, retrying while a save replaces them in between for the
+// signature to be the one of the opened file; a signature that still doesn't match, eg. left by a save without signing, is dropped
+func openSigned(path string) (*os.File, []byte, error) {
+	log := logger.Init("backup", "openSigned")
+
+	for attempt := 1; ; attempt++ {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		signature, err := os.ReadFile(path + index.SIGNATURE_SUFFIX)
+		if os.IsNotExist(err) {
+			return file, nil, nil
+		}
+		ok := false
+		if err == nil {
+			ok, err = signs(signature, file)
+		}
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		if ok {
+			return file, signature, nil
+		}
+		if attempt == MAX_SIGNATURE_ATTEMPTS {
+			log.Warn("Signature doesn't match the file, uploading it unsigned", "path", path)
+			return file, nil, nil
+		}
+		file.Close()
+		time.Sleep(time.Duration(attempt) * 50 * time.Millisecond)
+	}
+}
+
+// signs tells whether the passed content of a signature file holds the digest of the passed file, which is then read from the start again
+func signs(content []byte, file *os.File) (bool, error) {
+	var signature index.Signature
+	if err := json.Unmarshal(content, &signature); err != nil {
+		// Not a signature the restored index could be verified with anyway
+		return false, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return strings.EqualFold(signature.Digest, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// stateOf returns the state of the saved index file at the passed path
+func stateOf(path string) (state, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return state{}, err
+	}
+	return state{size: info.Size(), time: info.ModTime(), deltas: len(index.DeltaPaths(path))}, nil
+}
+
+// New returns a backup of the saved index to the bucket of the passed client, its objects being named with the passed prefix,
+// eg. `treee/`, and pruned according to the passed retention
+func New(client *s3.Client, prefix string, retention index.Retention) *Backup {
+	return &Backup{
+		client:    client,
+		prefix:    prefix,
+		retention: retention,
+	}
+}
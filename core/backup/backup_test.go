@@ -0,0 +1,178 @@
+package backup_test
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cyrildever/treee/core/backup"
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/utils/s3"
+	"gotest.tools/assert"
+)
+
+// bucket is a naive in-memory stand-in of an S3-compatible bucket, without multipart uploads nor pagination
+type bucket struct {
+	sync.Mutex
+	objects map[string][]byte
+	meta    map[string]string
+}
+
+func (b *bucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.Lock()
+	defer b.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") == "2" {
+			var keys []string
+			for k := range b.objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			fmt.Fprint(w, "<ListBucketResult>")
+			for _, k := range keys {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", k, len(b.objects[k]))
+			}
+			fmt.Fprint(w, "</ListBucketResult>")
+			return
+		}
+		content, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(s3.CHECKSUM_HEADER, b.meta[key])
+		_, _ = w.Write(content)
+	case http.MethodPut:
+		b.objects[key], _ = io.ReadAll(r.Body)
+		b.meta[key] = r.Header.Get(s3.CHECKSUM_HEADER)
+	case http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TestBackup ...
+func TestBackup(t *testing.T) {
+	fake := &bucket{objects: make(map[string][]byte), meta: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, _ := s3.New(server.URL, "", "bucket", "access", "secret")
+	backups := backup.New(client, "treee/", index.Retention{Last: 2})
+
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	_, err := backups.Restore(path)
+	_, ok := err.(*exception.NoGenerationError)
+	assert.Assert(t, ok)
+
+	treee, _ := index.New(101)
+	_, private, _ := index.GenerateSigningKey()
+	treee.UseSigning(private)
+	for i := 1; i <= 3; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+		_, _ = treee.SaveAs(path)
+		gen, err := backups.Push(path)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.HasPrefix(gen.File, "treee/treee-"))
+	}
+	all, err := backups.List()
+	assert.NilError(t, err)
+	assert.Equal(t, len(all), 2)
+	assert.Equal(t, len(fake.objects), 4) // With their signature
+
+	restored := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	gen, err := backups.Restore(restored)
+	assert.NilError(t, err)
+	assert.Equal(t, gen.File, all[1].File)
+	loaded, err := index.Load(restored)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(3))
+	err = index.VerifySignature(restored, []ed25519.PublicKey{private.Public().(ed25519.PublicKey)})
+	assert.NilError(t, err)
+
+	// Altered backup
+	fake.objects[gen.File][0] ^= 1
+	_ = os.Remove(restored)
+	_, err = backups.Restore(restored)
+	_, ok = err.(*s3.ChecksumError)
+	assert.Assert(t, ok)
+	_, err = os.Stat(restored)
+	assert.Assert(t, os.IsNotExist(err))
+
+	// Delta snapshots
+	treee.UseDeltas(10)
+	for i := 4; i <= 6; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+		_, err = treee.SaveDelta(path)
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, len(index.DeltaPaths(path)), 2) // The first save being a full one
+	gen, err = backups.Push(path)
+	assert.NilError(t, err)
+	_ = os.WriteFile(restored+index.DELTA_SUFFIX+"000001", []byte("stale"), 0600)
+	_, err = backups.Restore(restored)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(restored)), 2)
+	loaded, err = index.LoadVerified(restored, nil, []ed25519.PublicKey{private.Public().(ed25519.PublicKey)})
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(6))
+
+	// Pruned along with their backup
+	_, _ = backups.Push(path)
+	_, _ = backups.Push(path)
+	for key := range fake.objects {
+		assert.Assert(t, !strings.HasPrefix(key, gen.File), key)
+	}
+
+	// Signature of the uploaded file only
+	trusted := []ed25519.PublicKey{private.Public().(ed25519.PublicKey)}
+	other, _ := index.New(101)
+	other.UseSigning(private)
+	otherPath := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	_, _ = other.SaveAs(otherPath)
+	stop := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = other.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+			_, _ = other.SaveAs(otherPath)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err = backups.Push(otherPath)
+		assert.NilError(t, err)
+		_, err = backups.Restore(restored)
+		assert.NilError(t, err)
+		_, err = index.LoadVerified(restored, nil, trusted)
+		assert.NilError(t, err)
+	}
+	close(stop)
+	<-saved
+	other.UseSigning(nil)
+	_ = other.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1000)), Position: 10000, Size: 10})
+	_, _ = other.SaveAs(otherPath) // Leaving the signature of the previous save
+	gen, err = backups.Push(otherPath)
+	assert.NilError(t, err)
+	_, ok = fake.objects[gen.File+index.SIGNATURE_SUFFIX]
+	assert.Assert(t, !ok)
+}
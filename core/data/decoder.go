@@ -0,0 +1,223 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cyrildever/treee/core/model"
+)
+
+const (
+	// NDJSON stands for newline-delimited JSON records, the content of an item being its line without the line feed
+	NDJSON = "ndjson"
+	// LENGTH_PREFIXED stands for records made of a 4-byte big-endian length followed by the content of the item
+	LENGTH_PREFIXED = "length-prefixed"
+
+	// MAX_RECORD_SIZE is the size in bytes above which a length-prefixed record is deemed corrupted
+	MAX_RECORD_SIZE = 64 << 20
+)
+
+var decoders = map[string]DecoderFactory{
+	NDJSON:          NewNDJSONDecoder,
+	LENGTH_PREFIXED: NewLengthPrefixedDecoder,
+}
+
+//--- TYPES
+
+// Record is an item found in the data file
+type Record struct {
+	ID       model.Hash
+	Position int64
+	Size     int64
+	Previous model.Hash
+}
+
+// RecordDecoder reads the successive records of a data file
+type RecordDecoder interface {
+	// Next returns the next record, or `io.EOF` when there's no more complete record to read
+	Next() (*Record, error)
+	// Offset returns the position in the data file right after the last complete record read
+	Offset() int64
+}
+
+// Finalizer is implemented by the record decoders able to read the last record of a data file that isn't written anymore
+// even if it's not terminated as it would be while still being appended to
+type Finalizer interface {
+	// Final makes the decoder return the trailing unterminated record instead of `io.EOF`
+	Final()
+}
+
+// DecoderFactory builds a decoder reading records from the passed reader, which starts at `offset` in the data file,
+// the ID of a record being the hash of its content
+type DecoderFactory func(r io.Reader, offset int64, hasher Hasher) RecordDecoder
+
+type ndjsonDecoder struct {
+	reader *bufio.Reader
+	offset int64
+	hasher Hasher
+	final  bool
+}
+
+type lengthPrefixedDecoder struct {
+	reader *bufio.Reader
+	offset int64
+	hasher Hasher
+}
+
+//--- METHODS
+
+// Next ...
+func (d *ndjsonDecoder) Next() (*Record, error) {
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		if err == io.EOF && (!d.final || len(line) == 0) {
+			// A line not terminated yet is still being written
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		position := d.offset
+		d.offset += int64(len(line))
+		content := bytes.TrimSuffix(line, []byte{'\n'})
+		if len(bytes.TrimSpace(content)) == 0 {
+			continue
+		}
+		return newRecord(content, position, d.hasher)
+	}
+}
+
+// Final ...
+func (d *ndjsonDecoder) Final() {
+	d.final = true
+}
+
+// Offset ...
+func (d *ndjsonDecoder) Offset() int64 {
+	return d.offset
+}
+
+// Next ...
+func (d *lengthPrefixedDecoder) Next() (*Record, error) {
+	for {
+		prefix, err := d.reader.Peek(4)
+		if err == io.EOF || (err == nil && len(prefix) < 4) {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint32(prefix))
+		if length > MAX_RECORD_SIZE {
+			return nil, fmt.Errorf("record of %d bytes exceeds the maximum size of %d bytes", length, MAX_RECORD_SIZE)
+		}
+		record, err := d.reader.Peek(4 + length)
+		if err == io.EOF || err == bufio.ErrBufferFull {
+			if err == bufio.ErrBufferFull {
+				// Bigger than the buffer: read it in one go from now on
+				d.reader = bufio.NewReaderSize(d.reader, 4+length)
+				continue
+			}
+			// A record not complete yet is still being written
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		content := make([]byte, length)
+		copy(content, record[4:])
+		_, _ = d.reader.Discard(4 + length)
+		position := d.offset + 4
+		d.offset += int64(4 + length)
+		if length == 0 {
+			continue
+		}
+		return newRecord(content, position, d.hasher)
+	}
+}
+
+// Offset ...
+func (d *lengthPrefixedDecoder) Offset() int64 {
+	return d.offset
+}
+
+//--- FUNCTIONS
+
+// NewDecoder returns the decoder registered under the passed name
+func NewDecoder(name string, r io.Reader, offset int64, hasher Hasher) (RecordDecoder, error) {
+	factory, ok := decoders[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record decoder: %s", name)
+	}
+	return factory(r, offset, hasher), nil
+}
+
+// NewFinalDecoder returns the decoder registered under the passed name to read a data file that isn't written anymore,
+// ie. returning its trailing record even if it's not terminated when the decoder implements `Finalizer`
+func NewFinalDecoder(name string, r io.Reader, offset int64, hasher Hasher) (RecordDecoder, error) {
+	decoder, err := NewDecoder(name, r, offset, hasher)
+	if err != nil {
+		return nil, err
+	}
+	if finalizer, ok := decoder.(Finalizer); ok {
+		finalizer.Final()
+	}
+	return decoder, nil
+}
+
+// NewLengthPrefixedDecoder ...
+func NewLengthPrefixedDecoder(r io.Reader, offset int64, hasher Hasher) RecordDecoder {
+	return &lengthPrefixedDecoder{
+		reader: bufio.NewReader(r),
+		offset: offset,
+		hasher: hasher,
+	}
+}
+
+// NewNDJSONDecoder ...
+func NewNDJSONDecoder(r io.Reader, offset int64, hasher Hasher) RecordDecoder {
+	return &ndjsonDecoder{
+		reader: bufio.NewReader(r),
+		offset: offset,
+		hasher: hasher,
+	}
+}
+
+// RegisterDecoder makes a custom record decoder available under the passed name
+func RegisterDecoder(name string, factory DecoderFactory) {
+	decoders[strings.ToLower(name)] = factory
+}
+
+// Decoders lists the names of the available record decoders
+func Decoders() []string {
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRecord builds the record of the passed content, its previous item being read from the `previous` field of the content if it's a JSON object
+func newRecord(content []byte, position int64, hasher Hasher) (*Record, error) {
+	id, err := HashContent(bytes.NewReader(content), hasher)
+	if err != nil {
+		return nil, err
+	}
+	var fields struct {
+		Previous model.Hash `json:"previous"`
+	}
+	_ = json.Unmarshal(content, &fields)
+	return &Record{
+		ID:       id,
+		Position: position,
+		Size:     int64(len(content)),
+		Previous: fields.Previous,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package data_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/model"
+	"gotest.tools/assert"
+)
+
+// TestNDJSONDecoder ...
+func TestNDJSONDecoder(t *testing.T) {
+	first := `{"item":1}`
+	firstID := sha256Hash(first)
+	second := `{"item":2,"previous":"` + string(firstID) + `"}`
+	content := first + "\n\n" + second + "\n" + `{"item":3`
+
+	decoder, err := data.NewDecoder(data.NDJSON, strings.NewReader(content), 0, sha256.New)
+	assert.NilError(t, err)
+	record, err := decoder.Next()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *record, data.Record{ID: firstID, Position: 0, Size: int64(len(first))})
+	record, err = decoder.Next()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *record, data.Record{ID: sha256Hash(second), Position: int64(len(first) + 2), Size: int64(len(second)), Previous: firstID})
+
+	// The last line isn't complete yet
+	_, err = decoder.Next()
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, decoder.Offset(), int64(len(first)+len(second)+3))
+
+	// Unless the file isn't written anymore
+	decoder, err = data.NewFinalDecoder(data.NDJSON, strings.NewReader(content), 0, sha256.New)
+	assert.NilError(t, err)
+	_, _ = decoder.Next()
+	_, _ = decoder.Next()
+	record, err = decoder.Next()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *record, data.Record{ID: sha256Hash(`{"item":3`), Position: int64(len(first) + len(second) + 3), Size: 9})
+	_, err = decoder.Next()
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, decoder.Offset(), int64(len(content)))
+
+	_, err = data.NewDecoder("unknown", strings.NewReader(content), 0, sha256.New)
+	assert.Error(t, err, "unsupported record decoder: unknown")
+}
+
+// TestLengthPrefixedDecoder ...
+func TestLengthPrefixedDecoder(t *testing.T) {
+	items := []string{"first item", strings.Repeat("x", 10000)}
+	var buf bytes.Buffer
+	for _, item := range items {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(item)))
+		buf.WriteString(item)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint32(100))
+	buf.WriteString("incomplete")
+
+	decoder, err := data.NewDecoder(data.LENGTH_PREFIXED, &buf, 42, sha256.New)
+	assert.NilError(t, err)
+	record, err := decoder.Next()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *record, data.Record{ID: sha256Hash(items[0]), Position: 46, Size: 10})
+	record, err = decoder.Next()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *record, data.Record{ID: sha256Hash(items[1]), Position: 60, Size: 10000})
+	_, err = decoder.Next()
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, decoder.Offset(), int64(10060))
+
+	// A corrupted prefix doesn't make it allocate gigabytes
+	buf.Reset()
+	_ = binary.Write(&buf, binary.BigEndian, uint32(data.MAX_RECORD_SIZE+1))
+	buf.WriteString("corrupted")
+	decoder, err = data.NewFinalDecoder(data.LENGTH_PREFIXED, &buf, 0, sha256.New)
+	assert.NilError(t, err)
+	_, err = decoder.Next()
+	assert.ErrorContains(t, err, "exceeds the maximum size")
+}
+
+func sha256Hash(content string) model.Hash {
+	sum := sha256.Sum256([]byte(content))
+	return model.ToHash(sum[:])
+}
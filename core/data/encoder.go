@@ -0,0 +1,58 @@
+package data
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var encoders = map[string]RecordEncoder{
+	NDJSON:          encodeNDJSON,
+	LENGTH_PREFIXED: encodeLengthPrefixed,
+}
+
+//--- TYPES
+
+// RecordEncoder writes the passed content of an item as a record read back by the decoder of the same name,
+// returning the offset of the content in the record (ie. the size of its header) and the number of bytes written
+type RecordEncoder func(w io.Writer, content io.Reader, size int64) (header, written int64, err error)
+
+//--- FUNCTIONS
+
+// NewEncoder returns the encoder registered under the passed name
+func NewEncoder(name string) (RecordEncoder, error) {
+	encoder, ok := encoders[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record encoder: %s", name)
+	}
+	return encoder, nil
+}
+
+// RegisterEncoder makes a custom record encoder available under the passed name, usually the one of its decoder (see `RegisterDecoder()`)
+func RegisterEncoder(name string, encoder RecordEncoder) {
+	encoders[strings.ToLower(name)] = encoder
+}
+
+func encodeLengthPrefixed(w io.Writer, content io.Reader, size int64) (header, written int64, err error) {
+	if size > MAX_RECORD_SIZE {
+		err = fmt.Errorf("record of %d bytes exceeds the maximum size of %d bytes", size, MAX_RECORD_SIZE)
+		return
+	}
+	prefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(prefix, uint32(size))
+	if _, err = w.Write(prefix); err != nil {
+		return
+	}
+	n, err := io.CopyN(w, content, size)
+	return 4, 4 + n, err
+}
+
+func encodeNDJSON(w io.Writer, content io.Reader, size int64) (header, written int64, err error) {
+	n, err := io.CopyN(w, content, size)
+	if err != nil {
+		return 0, n, err
+	}
+	_, err = w.Write([]byte{'\n'})
+	return 0, n + 1, err
+}
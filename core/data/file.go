@@ -0,0 +1,42 @@
+package data
+
+import (
+	"os"
+)
+
+// Current is the immutable data used when running the executable app, if any
+var Current Source
+
+//--- TYPES
+
+// File is the immutable file the indexed items are stored in, only accessed for reading
+type File struct {
+	Path string
+	file *os.File
+}
+
+//--- METHODS
+
+// ReadAt implements `io.ReaderAt`
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+// Close ...
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+//--- FUNCTIONS
+
+// Open ...
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		Path: path,
+		file: f,
+	}, nil
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/cyrildever/treee/core/model"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// SHA256 ...
+	SHA256 = "sha256"
+	// SHA512 ...
+	SHA512 = "sha512"
+	// BLAKE2B stands for BLAKE2b-256
+	BLAKE2B = "blake2b"
+)
+
+//--- TYPES
+
+// Hasher builds a new hash for the algorithm used to compute the IDs of the items from their content
+type Hasher func() hash.Hash
+
+//--- FUNCTIONS
+
+// NewHasher returns the hasher for the passed algorithm name
+func NewHasher(algorithm string) (Hasher, error) {
+	switch strings.ToLower(algorithm) {
+	case SHA256, "":
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	case BLAKE2B:
+		return func() hash.Hash {
+			h, _ := blake2b.New256(nil)
+			return h
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
+}
+
+// HashContent computes the hash of the content read from the passed reader
+func HashContent(r io.Reader, hasher Hasher) (model.Hash, error) {
+	h := hasher()
+	if _, err := io.Copy(h, r); err != nil {
+		return model.EmptyHash, err
+	}
+	return model.ToHash(h.Sum(nil)), nil
+}
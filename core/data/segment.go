@@ -0,0 +1,128 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+//--- TYPES
+
+// Source gives access to the immutable data, either a single file or a set of segment files
+type Source interface {
+	// Segment returns the file of the passed segment, `0` being the only segment of a single file
+	Segment(n int) (io.ReaderAt, error)
+	Close() error
+}
+
+// Segments is a set of segment files the immutable storage rotates into, their paths being built from a pattern with a `%d` verb
+// for the segment number, eg. `data/segment-%05d.bin`
+type Segments struct {
+	Pattern string
+
+	mu    sync.Mutex
+	files map[int]*File
+}
+
+type singleFile struct {
+	io.ReaderAt
+}
+
+//--- METHODS
+
+// Path returns the path to the file of the passed segment
+func (s *Segments) Path(n int) string {
+	return SegmentPath(s.Pattern, n)
+}
+
+// Segment opens the file of the passed segment upon first use, so that the segments created after start-up are available as well
+func (s *Segments) Segment(n int) (io.ReaderAt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.files[n]; ok {
+		return f, nil
+	}
+	f, err := Open(s.Path(n))
+	if err != nil {
+		return nil, err
+	}
+	s.files[n] = f
+	return f, nil
+}
+
+// Close ...
+func (s *Segments) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n, f := range s.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(s.files, n)
+	}
+	return
+}
+
+// Segment ...
+func (s singleFile) Segment(n int) (io.ReaderAt, error) {
+	if n != 0 {
+		return nil, fmt.Errorf("no segment %d in a single data file", n)
+	}
+	return s.ReaderAt, nil
+}
+
+// Close ...
+func (s singleFile) Close() error {
+	if c, ok := s.ReaderAt.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+//--- FUNCTIONS
+
+// IsPattern tells whether the passed data path is a pattern of segment files rather than a single file
+func IsPattern(path string) bool {
+	return strings.Contains(path, "%")
+}
+
+// NewSegments ...
+func NewSegments(pattern string) *Segments {
+	return &Segments{
+		Pattern: pattern,
+		files:   make(map[int]*File),
+	}
+}
+
+// OpenSource opens the data at the passed path, either a single file or a pattern of segment files (see `IsPattern()`)
+func OpenSource(path string) (Source, error) {
+	if IsPattern(path) {
+		segments := NewSegments(path)
+		if _, err := os.Stat(segments.Path(0)); err != nil {
+			return nil, err
+		}
+		return segments, nil
+	}
+	f, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return SingleFile(f), nil
+}
+
+// SegmentPath returns the path to the file of the passed segment, or the path itself if it's not a pattern
+func SegmentPath(path string, n int) string {
+	if !IsPattern(path) {
+		return path
+	}
+	return fmt.Sprintf(path, n)
+}
+
+// SingleFile makes the passed reader the only segment of a data source
+func SingleFile(r io.ReaderAt) Source {
+	return singleFile{r}
+}
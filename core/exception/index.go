@@ -22,6 +22,40 @@ func NewAlreadyExistsInIndexError(id string) *AlreadyExistsInIndexError {
 	}
 }
 
+// BrokenChainError ...
+type BrokenChainError struct {
+	message string
+}
+
+func (e BrokenChainError) Error() string {
+	return e.message
+}
+
+// NewBrokenChainError ...
+func NewBrokenChainError(id string) *BrokenChainError {
+	return &BrokenChainError{
+		message: fmt.Sprintf("broken chain digest at ID: %s", id),
+	}
+}
+
+// ContentMismatchError ...
+type ContentMismatchError struct {
+	Actual  string
+	message string
+}
+
+func (e ContentMismatchError) Error() string {
+	return e.message
+}
+
+// NewContentMismatchError ...
+func NewContentMismatchError(id, actual string) *ContentMismatchError {
+	return &ContentMismatchError{
+		Actual:  actual,
+		message: fmt.Sprintf("ID %s doesn't match the hash of the content: %s", id, actual),
+	}
+}
+
 // EmptyItemError ...
 type EmptyItemError struct {
 	message string
@@ -54,6 +88,102 @@ func NewIncoherentSizeError(expected, found int) *IncoherentSizeError {
 	}
 }
 
+// InvalidCursorError ...
+type InvalidCursorError struct {
+	message string
+}
+
+func (e InvalidCursorError) Error() string {
+	return e.message
+}
+
+// NewInvalidCursorError ...
+func NewInvalidCursorError(cursor string) *InvalidCursorError {
+	return &InvalidCursorError{
+		message: fmt.Sprintf("invalid cursor: %s", cursor),
+	}
+}
+
+// InvalidPositionError ...
+type InvalidPositionError struct {
+	message string
+}
+
+func (e InvalidPositionError) Error() string {
+	return e.message
+}
+
+// NewInvalidPositionError ...
+func NewInvalidPositionError(position int64) *InvalidPositionError {
+	return &InvalidPositionError{
+		message: fmt.Sprintf("invalid position: %d", position),
+	}
+}
+
+// InvalidProofError ...
+type InvalidProofError struct {
+	message string
+}
+
+func (e InvalidProofError) Error() string {
+	return e.message
+}
+
+// NewInvalidProofError ...
+func NewInvalidProofError(reason string) *InvalidProofError {
+	return &InvalidProofError{
+		message: fmt.Sprintf("invalid proof: %s", reason),
+	}
+}
+
+// InvalidSignatureError ...
+type InvalidSignatureError struct {
+	message string
+}
+
+func (e InvalidSignatureError) Error() string {
+	return e.message
+}
+
+// NewInvalidSignatureError ...
+func NewInvalidSignatureError(reason string) *InvalidSignatureError {
+	return &InvalidSignatureError{
+		message: fmt.Sprintf("unable to verify index signature: %s", reason),
+	}
+}
+
+// InvalidSizeError ...
+type InvalidSizeError struct {
+	message string
+}
+
+func (e InvalidSizeError) Error() string {
+	return e.message
+}
+
+// NewInvalidSizeError ...
+func NewInvalidSizeError(size int64) *InvalidSizeError {
+	return &InvalidSizeError{
+		message: fmt.Sprintf("invalid size: %d", size),
+	}
+}
+
+// InvalidSortError ...
+type InvalidSortError struct {
+	message string
+}
+
+func (e InvalidSortError) Error() string {
+	return e.message
+}
+
+// NewInvalidSortError ...
+func NewInvalidSortError(order string) *InvalidSortError {
+	return &InvalidSortError{
+		message: fmt.Sprintf("invalid sort: %s", order),
+	}
+}
+
 // LoopError ...
 type LoopError struct {
 	message string
@@ -70,6 +200,22 @@ func NewLoopError(operation string) *LoopError {
 	}
 }
 
+// NoGenerationError ...
+type NoGenerationError struct {
+	message string
+}
+
+func (e NoGenerationError) Error() string {
+	return e.message
+}
+
+// NewNoGenerationError ...
+func NewNoGenerationError(at string) *NoGenerationError {
+	return &NoGenerationError{
+		message: fmt.Sprintf("no snapshot generation saved before %s", at),
+	}
+}
+
 // NotFoundError ...
 type NotFoundError struct {
 	message string
@@ -101,3 +247,99 @@ func NewNotAValidTreeeError() *NotAValidTreeeError {
 		message: "not a valid treee",
 	}
 }
+
+// NotInSameChainError ...
+type NotInSameChainError struct {
+	message string
+}
+
+func (e NotInSameChainError) Error() string {
+	return e.message
+}
+
+// NewNotInSameChainError ...
+func NewNotInSameChainError(a, b string) *NotInSameChainError {
+	return &NotInSameChainError{
+		message: fmt.Sprintf("items not in the same subchain: %s, %s", a, b),
+	}
+}
+
+// OutOfRangeError ...
+type OutOfRangeError struct {
+	message string
+}
+
+func (e OutOfRangeError) Error() string {
+	return e.message
+}
+
+// NewOutOfRangeError ...
+func NewOutOfRangeError(index, length int) *OutOfRangeError {
+	return &OutOfRangeError{
+		message: fmt.Sprintf("index out of range [%d] with length %d", index, length),
+	}
+}
+
+// OverlappingItemError ...
+type OverlappingItemError struct {
+	message string
+}
+
+func (e OverlappingItemError) Error() string {
+	return e.message
+}
+
+// NewOverlappingItemError ...
+func NewOverlappingItemError(id, existing string) *OverlappingItemError {
+	return &OverlappingItemError{
+		message: fmt.Sprintf("item %s overlaps existing item in file: %s", id, existing),
+	}
+}
+
+// ReadOnlyError ...
+type ReadOnlyError struct {
+	message string
+}
+
+func (e ReadOnlyError) Error() string {
+	return e.message
+}
+
+// NewReadOnlyError ...
+func NewReadOnlyError() *ReadOnlyError {
+	return &ReadOnlyError{
+		message: "the index is read-only",
+	}
+}
+
+// StaleRelocationError ...
+type StaleRelocationError struct {
+	message string
+}
+
+func (e StaleRelocationError) Error() string {
+	return e.message
+}
+
+// NewStaleRelocationError ...
+func NewStaleRelocationError(id string) *StaleRelocationError {
+	return &StaleRelocationError{
+		message: fmt.Sprintf("item moved or removed since the relocation was computed: %s", id),
+	}
+}
+
+// WrongKeyError ...
+type WrongKeyError struct {
+	message string
+}
+
+func (e WrongKeyError) Error() string {
+	return e.message
+}
+
+// NewWrongKeyError ...
+func NewWrongKeyError(reason string) *WrongKeyError {
+	return &WrongKeyError{
+		message: fmt.Sprintf("unable to decrypt index: %s", reason),
+	}
+}
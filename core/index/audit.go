@@ -0,0 +1,98 @@
+package index
+
+import (
+	"sync"
+
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+//--- TYPES
+
+// Mismatch is an item whose ID isn't the hash of its content in the data file
+type Mismatch struct {
+	ID     model.Hash `json:"id"`
+	Actual model.Hash `json:"actual,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+//--- METHODS
+
+// Audit re-hashes the content of every item in the data file with the passed number of workers, returning those whose ID doesn't match
+func (t *Treee) Audit(source data.Source, hasher data.Hasher, workers int) []Mismatch {
+	if workers < 1 {
+		workers = 1
+	}
+	leaves := make(chan *branch.Leaf, workers)
+	results := make(chan Mismatch, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for leaf := range leaves {
+				if err := checkContent(leaf, source, hasher); err != nil {
+					idStr, _ := leaf.ID.String()
+					mismatch := Mismatch{
+						ID: model.Hash(idStr),
+					}
+					if e, ok := err.(*exception.ContentMismatchError); ok {
+						mismatch.Actual = model.Hash(e.Actual)
+					} else {
+						mismatch.Error = err.Error()
+					}
+					results <- mismatch
+				}
+			}
+		}()
+	}
+	go func() {
+		t.Walk(func(leaf *branch.Leaf) bool {
+			leaves <- leaf
+			return true
+		})
+		close(leaves)
+		wg.Wait()
+		close(results)
+	}()
+
+	mismatches := []Mismatch{}
+	for mismatch := range results {
+		mismatches = append(mismatches, mismatch)
+	}
+	return mismatches
+}
+
+// UseContentCheck makes the index check upon insertion that the ID of an item is the hash of its content in the passed data;
+// passing a `nil` source deactivates it
+func (t *Treee) UseContentCheck(source data.Source, hasher data.Hasher) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.contentSource = source
+	t.hasher = hasher
+}
+
+//--- FUNCTIONS
+
+// checkContent returns a `ContentMismatchError` if the ID of the passed leaf isn't the hash of its content in the data file
+func checkContent(leaf *branch.Leaf, source data.Source, hasher data.Hasher) error {
+	idStr, err := leaf.ID.String()
+	if err != nil {
+		return err
+	}
+	section, err := LeafReader(leaf, source)
+	if err != nil {
+		return err
+	}
+	actual, err := data.HashContent(section, hasher)
+	if err != nil {
+		return err
+	}
+	if string(actual) != idStr {
+		return exception.NewContentMismatchError(idStr, string(actual))
+	}
+	return nil
+}
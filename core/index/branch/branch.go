@@ -1,12 +1,17 @@
 package branch
 
-import "github.com/cyrildever/treee/utils"
+import (
+	"io"
+
+	"github.com/cyrildever/treee/utils"
+)
 
 //--- TYPES
 
 // Branch ...
 type Branch struct {
 	nature interface{}
+	page   *page // Only set when the tree is backed by a page file
 }
 
 //--- METHODS
@@ -16,13 +21,18 @@ func (b *Branch) Assign(leafOrNodePtr interface{}) bool {
 	if !utils.IsPointer(leafOrNodePtr) {
 		return false
 	}
+	if b.page != nil {
+		b.page.pager.mu.Lock()
+		defer b.page.pager.mu.Unlock()
+		b.page.dirty = true
+	}
 	b.nature = leafOrNodePtr
 	return true
 }
 
 // GetLeaf ...
 func (b *Branch) GetLeaf() *Leaf {
-	if l, ok := b.nature.(*Leaf); ok {
+	if l, ok := b.get().(*Leaf); ok {
 		return l
 	}
 	return &Leaf{}
@@ -30,20 +40,34 @@ func (b *Branch) GetLeaf() *Leaf {
 
 // GetNode ...
 func (b *Branch) GetNode() *Node {
-	if n, ok := b.nature.(*Node); ok {
+	if n, ok := b.get().(*Node); ok {
 		return n
 	}
 	return &Node{}
 }
 
+// Err returns the error met reading the content of the branch from the page file, if any, in which case the branch is neither empty,
+// a leaf nor a node
+func (b *Branch) Err() error {
+	if u, ok := b.get().(unreadable); ok {
+		return u.err
+	}
+	return nil
+}
+
 // IsEmpty ...
 func (b *Branch) IsEmpty() bool {
-	return b.nature == nil || (!b.IsLeaf() && !b.IsNode())
+	switch b.get().(type) {
+	case *Leaf, *Node, unreadable:
+		return false
+	default:
+		return true
+	}
 }
 
 // IsLeaf ...
 func (b *Branch) IsLeaf() bool {
-	nature := b.nature
+	nature := b.get()
 	if _, ok := nature.(*Leaf); ok {
 		return true
 	}
@@ -52,7 +76,7 @@ func (b *Branch) IsLeaf() bool {
 
 // IsNode ...
 func (b *Branch) IsNode() bool {
-	nature := b.nature
+	nature := b.get()
 	if _, ok := nature.(*Node); ok {
 		return true
 	}
@@ -61,13 +85,36 @@ func (b *Branch) IsNode() bool {
 
 // Print ...
 func (b *Branch) Print() string {
-	if b.IsLeaf() {
-		l, _ := b.nature.(*Leaf)
-		return l.Print()
-	} else if b.IsNode() {
-		n, _ := b.nature.(*Node)
-		return n.Print()
-	} else {
+	switch content := b.get().(type) {
+	case *Leaf:
+		return content.Print()
+	case *Node:
+		return content.Print()
+	default:
 		return "{}"
 	}
 }
+
+// WriteTo writes the JSON representation of the branch to the passed writer; it implements `io.WriterTo`
+func (b *Branch) WriteTo(w io.Writer) (int64, error) {
+	switch content := b.get().(type) {
+	case *Node:
+		return content.WriteTo(w)
+	case unreadable:
+		return 0, content.err
+	}
+	c, err := io.WriteString(w, b.Print())
+	return int64(c), err
+}
+
+// get returns the leaf or node of the branch, reading it from the page file if needed, or `unreadable` if it can't be
+func (b *Branch) get() interface{} {
+	if b.page == nil {
+		return b.nature
+	}
+	content, err := b.page.pager.get(b)
+	if err != nil {
+		return unreadable{err: err}
+	}
+	return content
+}
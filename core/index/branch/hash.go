@@ -0,0 +1,189 @@
+package branch
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+
+	"github.com/cyrildever/treee/core/model"
+)
+
+// Domain separation of the hashed contents
+const (
+	leafTag byte = 0
+	nodeTag byte = 1
+	pairTag byte = 2
+)
+
+// emptySlots[h] is the hash of a subtree of height h of the slots of a node holding no leaf nor node, the hash of an empty slot being zero
+var emptySlots = func() [][]byte {
+	hashes := make([][]byte, 65)
+	hashes[0] = make([]byte, sha256.Size)
+	for h := 1; h < len(hashes); h++ {
+		hashes[h] = pair(hashes[h-1], hashes[h-1])
+	}
+	return hashes
+}()
+
+//--- TYPES
+
+// slot is a non-empty child of a node along with its hash
+type slot struct {
+	remainder uint64
+	hash      []byte
+}
+
+//--- METHODS
+
+// Hash returns the hash of the node, ie. of its stage prime and of the root of the Merkle tree of its `StagePrime` slots ordered by remainder,
+// each slot being the hash of a node, the hash of the ID of a leaf (see `LeafHash()`) or zero if empty (or holding the shadow of a removed leaf).
+// It only commits to the IDs of the leaves under the node, not to their other fields, and is kept until `Invalidate()` is called.
+func (n *Node) Hash() []byte {
+	if cached := n.hash.Load(); cached != nil {
+		return *cached
+	}
+	root := subtree(n.slots(), 0, slotHeight(n.StagePrime))
+	hash := nodeHash(n.StagePrime, root)
+	n.hash.Store(&hash)
+	return hash
+}
+
+// Invalidate forgets the hash of the node, to be called whenever a leaf or node is added under it or a leaf removed
+func (n *Node) Invalidate() {
+	n.hash.Store(nil)
+}
+
+// Siblings returns the hashes needed to compute the hash of the node from the slot at the passed remainder, from the bottom up
+// (see `NodeHash()`)
+func (n *Node) Siblings(idx uint64) [][]byte {
+	slots := n.slots()
+	height := slotHeight(n.StagePrime)
+	siblings := make([][]byte, height)
+	lo := uint64(0)
+	for h := height; h > 0; h-- {
+		mid := lo + 1<<(h-1)
+		split := sort.Search(len(slots), func(i int) bool { return slots[i].remainder >= mid })
+		if idx < mid {
+			siblings[h-1] = subtree(slots[split:], mid, h-1)
+			slots = slots[:split]
+		} else {
+			siblings[h-1] = subtree(slots[:split], lo, h-1)
+			slots = slots[split:]
+			lo = mid
+		}
+	}
+	return siblings
+}
+
+// SlotHash returns the hash of the branch as a slot of its node, ie. the hash of its node or of the ID of its leaf, or zero if empty
+func (b *Branch) SlotHash() []byte {
+	switch content := b.get().(type) {
+	case *Node:
+		return content.Hash()
+	case *Leaf:
+		if !content.IsEmpty() {
+			return LeafHash(content.ID)
+		}
+	}
+	return emptySlots[0]
+}
+
+// slots returns the non-empty children of the node ordered by remainder
+func (n *Node) slots() []slot {
+	slots := make([]slot, 0, len(n.children))
+	for i, b := range n.children {
+		if hash := b.SlotHash(); !isEmptySlot(hash) {
+			slots = append(slots, slot{remainder: i, hash: hash})
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].remainder < slots[j].remainder
+	})
+	return slots
+}
+
+//--- FUNCTIONS
+
+// EmptySlotHash returns the hash of an empty slot of a node
+func EmptySlotHash() []byte {
+	return emptySlots[0]
+}
+
+// LeafHash returns the hash of a leaf with the passed ID as a slot of its node
+func LeafHash(id model.Hash) []byte {
+	idStr, _ := id.String()
+	h := sha256.New()
+	h.Write([]byte{leafTag})
+	h.Write([]byte(idStr))
+	return h.Sum(nil)
+}
+
+// NodeHash computes the hash of a node with the passed stage prime from the hash of its slot at the passed remainder
+// and the siblings of this slot (see `Node.Siblings()`)
+func NodeHash(stagePrime, idx uint64, slotHash []byte, siblings [][]byte) ([]byte, error) {
+	if idx >= stagePrime {
+		return nil, errors.New("remainder out of the node")
+	}
+	if len(siblings) != slotHeight(stagePrime) {
+		return nil, errors.New("wrong number of siblings")
+	}
+	hash := slotHash
+	for h, sibling := range siblings {
+		if (idx>>h)&1 == 0 {
+			hash = pair(hash, sibling)
+		} else {
+			hash = pair(sibling, hash)
+		}
+	}
+	return nodeHash(stagePrime, hash), nil
+}
+
+func isEmptySlot(hash []byte) bool {
+	for _, b := range hash {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeHash(stagePrime uint64, root []byte) []byte {
+	prefix := make([]byte, 9)
+	prefix[0] = nodeTag
+	binary.BigEndian.PutUint64(prefix[1:], stagePrime)
+	h := sha256.New()
+	h.Write(prefix)
+	h.Write(root)
+	return h.Sum(nil)
+}
+
+func pair(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{pairTag})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// slotHeight returns the height of the Merkle tree of the slots of a node with the passed stage prime
+func slotHeight(stagePrime uint64) int {
+	if stagePrime < 2 {
+		return 0
+	}
+	return bits.Len64(stagePrime - 1)
+}
+
+// subtree returns the root of the subtree of height h starting at the remainder `lo` holding the passed slots
+func subtree(slots []slot, lo uint64, h int) []byte {
+	if len(slots) == 0 {
+		return emptySlots[h]
+	}
+	if h == 0 {
+		return slots[0].hash
+	}
+	mid := lo + 1<<(h-1)
+	split := sort.Search(len(slots), func(i int) bool { return slots[i].remainder >= mid })
+	return pair(subtree(slots[:split], lo, h-1), subtree(slots[split:], mid, h-1))
+}
@@ -1,6 +1,8 @@
 package branch
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 
 	"github.com/cyrildever/treee/core/model"
@@ -11,15 +13,38 @@ import (
 // Leaf ...
 type Leaf struct {
 	ID       model.Hash `json:"id"`
+	Segment  int        `json:"segment,omitempty"`
 	Position int64      `json:"position"`
 	Size     int64      `json:"size"`
 	Origin   model.Hash `json:"origin"`
 	Previous model.Hash `json:"previous"`
 	Next     model.Hash `json:"next"`
+	Digest   model.Hash `json:"digest,omitempty"`
 }
 
 //--- METHODS
 
+// ChainDigest computes the running digest of the leaf in its subchain from the digest of its predecessor (empty for an origin),
+// ie. the SHA-256 hash of the predecessor's digest, the leaf ID, its origin and its size.
+//
+// NB: the segment and position aren't part of it so that the data file could be compacted or split without rewriting the chain history.
+func (l *Leaf) ChainDigest(predecessor model.Hash) model.Hash {
+	h := sha256.New()
+	if bytes, err := predecessor.Bytes(); err == nil {
+		h.Write(bytes)
+	}
+	if bytes, err := l.ID.Bytes(); err == nil {
+		h.Write(bytes)
+	}
+	if bytes, err := l.Origin.Bytes(); err == nil {
+		h.Write(bytes)
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(l.Size))
+	h.Write(size)
+	return model.ToHash(h.Sum(nil))
+}
+
 // IsEmpty ...
 func (l *Leaf) IsEmpty() bool {
 	return l.ID.IsEmpty() || l.Position == -1 || l.Size == 0
@@ -42,5 +67,6 @@ func NewEmptyLeaf() *Leaf {
 		Origin:   model.EmptyHash,
 		Previous: model.EmptyHash,
 		Next:     model.EmptyHash,
+		Digest:   model.EmptyHash,
 	}
 }
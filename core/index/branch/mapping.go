@@ -0,0 +1,23 @@
+package branch
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// record returns the kind and payload of the record at the passed offset of the page file, which ends at `end`
+func (m *mapping) record(offset, end int64) (kind byte, payload []byte, err error) {
+	if offset < headerSize || offset+5 > end {
+		return 0, nil, errors.New("record out of the page file")
+	}
+	header, err := m.read(offset, 5)
+	if err != nil {
+		return
+	}
+	length := int64(binary.BigEndian.Uint32(header[1:]))
+	if offset+5+length > end {
+		return 0, nil, errors.New("record out of the page file")
+	}
+	payload, err = m.read(offset+5, length)
+	return header[0], payload, err
+}
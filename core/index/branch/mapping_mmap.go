@@ -0,0 +1,41 @@
+//go:build linux || darwin
+
+package branch
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapping is the read-only memory map of the page file, its pages being loaded by the operating system on demand
+type mapping struct {
+	data []byte
+}
+
+func (m *mapping) close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
+
+// read returns a copy of the passed section so that it remains valid after a remapping
+func (m *mapping) read(offset, length int64) ([]byte, error) {
+	bytes := make([]byte, length)
+	copy(bytes, m.data[offset:offset+length])
+	return bytes, nil
+}
+
+func (m *mapping) remap(f *os.File, size int64) error {
+	if err := m.close(); err != nil {
+		return err
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	return nil
+}
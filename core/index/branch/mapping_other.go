@@ -0,0 +1,28 @@
+//go:build !linux && !darwin
+
+package branch
+
+import (
+	"os"
+)
+
+// mapping reads the page file directly on platforms without memory mapping
+type mapping struct {
+	file *os.File
+}
+
+func (m *mapping) close() error {
+	m.file = nil
+	return nil
+}
+
+func (m *mapping) read(offset, length int64) ([]byte, error) {
+	bytes := make([]byte, length)
+	_, err := m.file.ReadAt(bytes, offset)
+	return bytes, err
+}
+
+func (m *mapping) remap(f *os.File, _ int64) error {
+	m.file = f
+	return nil
+}
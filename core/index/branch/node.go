@@ -1,9 +1,11 @@
 package branch
 
 import (
+	"io"
 	"math/big"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/cyrildever/treee/utils/prime"
 )
@@ -14,6 +16,7 @@ import (
 type Node struct {
 	StagePrime uint64
 	children   map[uint64]*Branch
+	hash       atomic.Pointer[[]byte] // The cached hash of the node, see `Hash()`
 }
 
 //--- METHODS
@@ -68,7 +71,7 @@ func (n *Node) AddLeaf(item *Leaf) bool {
 
 // AddNode ...
 func (n *Node) AddNode(item *Node, idx uint64) bool {
-	if _, exists := n.children[idx]; !exists {
+	if existing, exists := n.children[idx]; !exists || existing.IsEmpty() {
 		newBranch := Branch{}
 		if !newBranch.Assign(item) {
 			return false
@@ -87,22 +90,67 @@ func (n *Node) ChildAt(idx uint64) (b *Branch, exists bool) {
 	return
 }
 
+// Walk calls the passed function on every non-empty leaf under the node in ascending order of remainders until it returns `false`;
+// it returns `false` if the walk was interrupted
+func (n *Node) Walk(fn func(*Leaf) bool) bool {
+	for i := uint64(0); i < n.StagePrime; i++ {
+		b, exists := n.children[i]
+		if !exists {
+			continue
+		}
+		if b.IsLeaf() {
+			if l := b.GetLeaf(); !l.IsEmpty() && !fn(l) {
+				return false
+			}
+		} else if b.IsNode() {
+			if !b.GetNode().Walk(fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Print ...
 func (n *Node) Print() string {
-	str := `{"stagePrime":` + strconv.FormatUint(n.StagePrime, 10) + ","
-	if len(n.children) > 0 {
-		str += `"children":[`
-		children := []string{}
-		for i, b := range n.children {
-			children = append(children, `{"`+strconv.FormatUint(i, 10)+`": `+b.Print()+"}")
+	var sb strings.Builder
+	_, _ = n.WriteTo(&sb)
+	return sb.String()
+}
+
+// WriteTo writes the JSON representation of the node to the passed writer as it goes, so that a whole tree could be written without
+// building it in memory first; it implements `io.WriterTo`
+func (n *Node) WriteTo(w io.Writer) (int64, error) {
+	written := int64(0)
+	write := func(str string) error {
+		c, err := io.WriteString(w, str)
+		written += int64(c)
+		return err
+	}
+	if err := write(`{"stagePrime":` + strconv.FormatUint(n.StagePrime, 10) + `,"children":[`); err != nil {
+		return written, err
+	}
+	first := true
+	for i, b := range n.children {
+		prefix := `{"`
+		if !first {
+			prefix = `,{"`
+		}
+		first = false
+		if err := write(prefix + strconv.FormatUint(i, 10) + `": `); err != nil {
+			return written, err
+		}
+		c, err := b.WriteTo(w)
+		written += c
+		if err != nil {
+			return written, err
+		}
+		if err = write("}"); err != nil {
+			return written, err
 		}
-		str += strings.Join(children, ",")
-		str += "]"
-	} else {
-		str += `"children":[]`
 	}
-	str += "}"
-	return str
+	err := write("]}")
+	return written, err
 }
 
 //--- FUNCTIONS
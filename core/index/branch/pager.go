@@ -0,0 +1,711 @@
+package branch
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cyrildever/treee/common/logger"
+)
+
+const (
+	pageMagic  = "TREEEPG1"
+	headerSize = 64
+
+	kindNode byte = 1
+	kindLeaf byte = 2
+
+	// COMPACTION_MIN_SIZE is the size in bytes from which a page file gets compacted by `Flush()` once more than half of it is obsolete
+	COMPACTION_MIN_SIZE = 1 << 20
+)
+
+//--- TYPES
+
+// Pager backs a tree with a page file, reading its nodes and leaves on demand and keeping at most a given number of them in memory,
+// the least recently used being evicted first unless they were modified since the last flush, ie. assigned or passed to `Touch()`.
+// Reading a branch already in memory only takes
+// a read lock and marks it as used, which gives it a second chance upon eviction, so that readers don't wait for each other.
+//
+// The page file is append-only: a flush writes the modified nodes and leaves, and all their ancestors up to the trunk, at the end of the file
+// before pointing its header to the new trunk, so that a crash leaves the file as it was at the previous flush; the records it made obsolete
+// are reclaimed by `Compact()`, which rewrites the file with only the current ones.
+// It starts with a header made of the `TREEEPG1` magic bytes, the initial prime, the size of the tree, the offset of the trunk and the end of
+// the data, all as big-endian 64-bit integers; each record is then made of its kind (`1` for a node, `2` for a leaf), the 32-bit length
+// of its payload and the payload itself, ie. the stage prime, the number of children and each non-empty child as its remainder (32 bits),
+// kind and offset for a node, or the JSON representation for a leaf.
+type Pager struct {
+	InitPrime uint64
+	Size      uint64
+
+	mu       sync.RWMutex
+	path     string
+	file     *os.File
+	mapping  mapping
+	end      int64
+	garbage  int64 // Size of the records made obsolete since the file was opened or compacted
+	root     *Branch
+	lru      *list.List
+	leaves   map[*Leaf]*page // The pages of the leaves in memory, for `Touch()`
+	capacity int
+	held     bool
+}
+
+// page tells where the content of a branch was last read from or written to in the page file
+type page struct {
+	pager  *Pager
+	kind   byte
+	offset int64
+	size   int64         // Size of the record, if known
+	dirty  bool          // Set when the content changed since it was read or written
+	elem   *list.Element // The entry of the branch in the LRU list when its content is in memory
+	used   atomic.Bool   // Set when the content is read, cleared when it gets a second chance upon eviction
+}
+
+// entry is a non-empty child of a node record
+type entry struct {
+	remainder uint64
+	kind      byte
+	offset    int64
+}
+
+// recordWriter appends records to a page file being compacted
+type recordWriter struct {
+	w   *bufio.Writer
+	end int64
+}
+
+// unloaded is the nature of a branch whose content wasn't read from the page file yet, or was evicted
+type unloaded struct{}
+
+// unreadable is what a branch returns instead of its content when it couldn't be read from the page file, its nature staying unloaded
+// for the next call to try again
+type unreadable struct {
+	err error
+}
+
+//--- METHODS
+
+// Close ...
+func (p *Pager) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.mapping.close()
+	if e := p.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Flush writes all the nodes and leaves modified since the last flush to the page file along with the passed size of the tree,
+// and compacts the file if more than half of it is obsolete
+func (p *Pager) Flush(size uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.flush(size); err != nil {
+		return err
+	}
+	if p.end >= COMPACTION_MIN_SIZE && p.garbage > (p.end-headerSize)/2 {
+		return p.compact()
+	}
+	return nil
+}
+
+// Compact flushes the passed size of the tree and rewrites the page file with only the records of the current tree,
+// atomically replacing it once complete so that a crash leaves it as it was
+func (p *Pager) Compact(size uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.flush(size); err != nil {
+		return err
+	}
+	return p.compact()
+}
+
+// End returns the size of the page file
+func (p *Pager) End() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.end
+}
+
+// flush writes the changes to the page file; it must be called with the lock held
+func (p *Pager) flush(size uint64) error {
+	var buf bytes.Buffer
+	root, _, _, err := p.persist(p.root, &buf, true)
+	if err != nil {
+		return err
+	}
+	if buf.Len() == 0 && size == p.Size {
+		return nil
+	}
+	if _, err = p.file.WriteAt(buf.Bytes(), p.end); err != nil {
+		return err
+	}
+	if err = p.file.Sync(); err != nil {
+		return err
+	}
+	end := p.end + int64(buf.Len())
+	if err = writeHeader(p.file, p.InitPrime, size, root, end); err != nil {
+		return err
+	}
+	if err = p.file.Sync(); err != nil {
+		return err
+	}
+	p.end = end
+	p.Size = size
+	if err = p.mapping.remap(p.file, end); err != nil {
+		return err
+	}
+	if !p.held {
+		p.trim()
+	}
+	return nil
+}
+
+// Hold prevents any eviction until `Release()` is called, so that the nodes and leaves a writer is about to modify stay in the tree
+func (p *Pager) Hold() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.held = true
+}
+
+// Loaded returns the number of nodes and leaves currently in memory
+func (p *Pager) Loaded() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.lru.Len()
+}
+
+// Release ends a `Hold()`, evicting what exceeds the capacity
+func (p *Pager) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.held = false
+	p.trim()
+}
+
+// Root returns the trunk of the tree
+func (p *Pager) Root() *Node {
+	return p.root.nature.(*Node)
+}
+
+// Touch marks the passed leaves as modified in place, for them to be written at the next flush
+func (p *Pager) Touch(leaves ...*Leaf) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, leaf := range leaves {
+		if pg, ok := p.leaves[leaf]; ok {
+			pg.dirty = true
+		}
+	}
+}
+
+// get returns the content of the passed branch, only taking the write lock if it has to be read from the page file
+func (p *Pager) get(b *Branch) (interface{}, error) {
+	p.mu.RLock()
+	if _, ok := b.nature.(unloaded); !ok {
+		b.page.used.Store(true)
+		content := b.nature
+		p.mu.RUnlock()
+		return content, nil
+	}
+	p.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resolve(b)
+}
+
+// resolve returns the content of the passed branch, reading it from the page file if needed; it must be called with the lock held
+func (p *Pager) resolve(b *Branch) (interface{}, error) {
+	if _, ok := b.nature.(unloaded); !ok {
+		b.page.used.Store(true)
+		return b.nature, nil
+	}
+	content, err := p.load(b.page)
+	if err != nil {
+		log := logger.Init("branch", "Pager")
+		log.Error("Unable to read page file", "offset", b.page.offset, "error", err)
+		return nil, fmt.Errorf("unable to read page file at offset %d: %w", b.page.offset, err)
+	}
+	b.nature = content
+	if leaf, ok := content.(*Leaf); ok {
+		p.leaves[leaf] = b.page
+	}
+	b.page.elem = p.lru.PushFront(b)
+	if !p.held {
+		// The content is returned even if the branch gets evicted again along with an ancestor
+		p.trim()
+	}
+	return content, nil
+}
+
+// load reads and decodes the record at the passed page, filling in its size
+func (p *Pager) load(pg *page) (interface{}, error) {
+	kind, payload, err := p.mapping.record(pg.offset, p.end)
+	if err != nil {
+		return nil, err
+	}
+	if kind != pg.kind {
+		return nil, fmt.Errorf("unexpected record kind %d at offset %d", kind, pg.offset)
+	}
+	pg.size = int64(5 + len(payload))
+	switch kind {
+	case kindLeaf:
+		leaf := Leaf{}
+		if err = json.Unmarshal(payload, &leaf); err != nil {
+			return nil, err
+		}
+		return &leaf, nil
+	case kindNode:
+		return p.decodeNode(payload)
+	default:
+		return nil, fmt.Errorf("unknown record kind %d at offset %d", kind, pg.offset)
+	}
+}
+
+// decodeNode builds a node whose children are left unloaded
+func (p *Pager) decodeNode(payload []byte) (*Node, error) {
+	stagePrime, entries, err := decodeNode(payload)
+	if err != nil {
+		return nil, err
+	}
+	node := NewNode(stagePrime)
+	for _, e := range entries {
+		node.children[e.remainder] = &Branch{
+			nature: unloaded{},
+			page: &page{
+				pager:  p,
+				kind:   e.kind,
+				offset: e.offset,
+			},
+		}
+	}
+	return node, nil
+}
+
+// compact rewrites the page file with only the records reachable from the trunk, which must be flushed; it must be called with the lock held
+func (p *Pager) compact() error {
+	path := p.path + ".compacting"
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := &recordWriter{
+		w:   bufio.NewWriter(io.NewOffsetWriter(f, headerSize)),
+		end: headerSize,
+	}
+	// The pages of the branches in memory only move once the new file replaced the old one
+	moves := make(map[*page]int64)
+	root, _, err := p.rewrite(p.root, w, moves)
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = writeHeader(f, p.InitPrime, p.Size, root, w.end)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(path, p.path)
+	}
+	if err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+
+	for pg, offset := range moves {
+		pg.offset = offset
+	}
+	_ = p.file.Close()
+	p.file = f
+	p.end = w.end
+	p.garbage = 0
+	return p.mapping.remap(f, p.end)
+}
+
+// rewrite writes the passed branch and everything under it to the page file being compacted, returning its new offset and kind
+func (p *Pager) rewrite(b *Branch, w *recordWriter, moves map[*page]int64) (offset int64, kind byte, err error) {
+	switch content := b.nature.(type) {
+	case unloaded:
+		offset, err = p.copyRecord(b.page.kind, b.page.offset, w)
+		kind = b.page.kind
+	case *Leaf:
+		if content.IsEmpty() {
+			return
+		}
+		payload, _ := json.Marshal(content)
+		kind = kindLeaf
+		offset, err = w.write(kind, payload)
+	case *Node:
+		var entries []entry
+		for i := uint64(0); i < content.StagePrime; i++ {
+			child, exists := content.children[i]
+			if !exists {
+				continue
+			}
+			childOffset, childKind, e := p.rewrite(child, w, moves)
+			if e != nil {
+				return 0, 0, e
+			}
+			if childKind != 0 {
+				entries = append(entries, entry{remainder: i, kind: childKind, offset: childOffset})
+			}
+		}
+		payload := encodeNode(content.StagePrime, entries)
+		kind = kindNode
+		offset, err = w.write(kind, payload)
+	default:
+		return
+	}
+	if err == nil && b.page != nil {
+		moves[b.page] = offset
+	}
+	return
+}
+
+// copyRecord copies the record of the passed kind at the passed offset of the page file, and everything under it, to the page file being compacted,
+// returning its new offset
+func (p *Pager) copyRecord(kind byte, offset int64, w *recordWriter) (int64, error) {
+	recordKind, payload, err := p.mapping.record(offset, p.end)
+	if err != nil {
+		return 0, err
+	}
+	if recordKind != kind {
+		return 0, fmt.Errorf("unexpected record kind %d at offset %d", recordKind, offset)
+	}
+	if kind == kindNode {
+		stagePrime, entries, err := decodeNode(payload)
+		if err != nil {
+			return 0, err
+		}
+		for i, e := range entries {
+			if entries[i].offset, err = p.copyRecord(e.kind, e.offset, w); err != nil {
+				return 0, err
+			}
+		}
+		payload = encodeNode(stagePrime, entries)
+	}
+	return w.write(kind, payload)
+}
+
+// persist returns the kind and offset of the content of the passed branch in the page file and whether it changed since it was read or written,
+// ie. if it was assigned or touched, or if any branch under it changed; if `write` is `false`, it only checks that nothing changed, returning
+// `errDirty` otherwise, else it appends to the passed buffer whatever changed and updates the branches accordingly.
+// An empty branch returns a zero kind.
+func (p *Pager) persist(b *Branch, buf *bytes.Buffer, write bool) (offset int64, kind byte, changed bool, err error) {
+	var payload []byte
+	switch content := b.nature.(type) {
+	case unloaded:
+		return b.page.offset, b.page.kind, false, nil
+	case *Leaf:
+		if content.IsEmpty() {
+			if b.page != nil {
+				// A removed leaf mustn't be evicted before its parent was written without it, or it would be read again
+				if !write {
+					return 0, 0, true, errDirty
+				}
+				if b.page.elem != nil {
+					p.lru.Remove(b.page.elem)
+				}
+				p.forget(content, b.page)
+				p.garbage += b.page.size
+				b.page = nil
+				changed = true
+			}
+			return
+		}
+		kind = kindLeaf
+		changed = b.page == nil || b.page.dirty || b.page.kind != kind
+		if changed && write {
+			payload, _ = json.Marshal(content)
+		}
+	case *Node:
+		kind = kindNode
+		changed = b.page == nil || b.page.dirty || b.page.kind != kind
+		var entries []entry
+		for i := uint64(0); i < content.StagePrime; i++ {
+			child, exists := content.children[i]
+			if !exists {
+				continue
+			}
+			childOffset, childKind, childChanged, e := p.persist(child, buf, write)
+			if e != nil {
+				return 0, 0, true, e
+			}
+			changed = changed || childChanged
+			if childKind != 0 {
+				entries = append(entries, entry{remainder: i, kind: childKind, offset: childOffset})
+			}
+		}
+		if changed && write {
+			payload = encodeNode(content.StagePrime, entries)
+		}
+	default:
+		return
+	}
+
+	if !changed {
+		return b.page.offset, kind, false, nil
+	}
+	if !write {
+		return 0, kind, true, errDirty
+	}
+	offset = p.end + int64(buf.Len())
+	header := make([]byte, 5)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	buf.Write(header)
+	buf.Write(payload)
+	if b.page == nil {
+		b.page = &page{
+			pager: p,
+		}
+	}
+	if b.page.kind != 0 {
+		// The record it was read from or last written to is now obsolete
+		p.garbage += b.page.size
+	}
+	b.page.kind = kind
+	b.page.offset = offset
+	b.page.size = int64(len(header) + len(payload))
+	b.page.dirty = false
+	if leaf, ok := b.nature.(*Leaf); ok {
+		p.leaves[leaf] = b.page
+	}
+	if b.page.elem == nil && b != p.root {
+		b.page.elem = p.lru.PushFront(b)
+	}
+	return offset, kind, true, nil
+}
+
+// trim evicts the least recently used nodes and leaves beyond the capacity, provided they're unchanged since the last flush and weren't
+// read since they were last given a second chance (in which case the capacity may be exceeded until the next call);
+// it must be called with the lock held
+func (p *Pager) trim() {
+	attempts := 2 * (p.lru.Len() - p.capacity)
+	for p.lru.Len() > p.capacity && attempts > 0 {
+		attempts--
+		elem := p.lru.Back()
+		b := elem.Value.(*Branch)
+		if b.page.used.Swap(false) {
+			p.lru.MoveToFront(elem)
+			continue
+		}
+		if _, _, _, err := p.persist(b, nil, false); err != nil {
+			// Modified: it must wait for the next flush
+			p.lru.MoveToFront(elem)
+			continue
+		}
+		p.evict(b)
+	}
+}
+
+// evict unloads the passed branch and everything under it
+func (p *Pager) evict(b *Branch) {
+	if node, ok := b.nature.(*Node); ok {
+		for _, child := range node.children {
+			if child.page != nil && child.page.elem != nil {
+				p.evict(child)
+			}
+		}
+	}
+	if leaf, ok := b.nature.(*Leaf); ok {
+		p.forget(leaf, b.page)
+	}
+	b.nature = unloaded{}
+	if b.page.elem != nil {
+		p.lru.Remove(b.page.elem)
+		b.page.elem = nil
+	}
+}
+
+// forget stops tracking the passed leaf for `Touch()` if it's still at the passed page
+func (p *Pager) forget(leaf *Leaf, pg *page) {
+	if p.leaves[leaf] == pg {
+		delete(p.leaves, leaf)
+	}
+}
+
+// write appends the passed record, returning its offset
+func (w *recordWriter) write(kind byte, payload []byte) (int64, error) {
+	offset := w.end
+	header := make([]byte, 5)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.w.Write(header); err != nil {
+		return 0, err
+	}
+	if _, err := w.w.Write(payload); err != nil {
+		return 0, err
+	}
+	w.end += int64(len(header) + len(payload))
+	return offset, nil
+}
+
+//--- FUNCTIONS
+
+// CreatePages writes the passed tree to a new page file at the passed path, which must not exist
+func CreatePages(path string, root *Node, initPrime, size uint64) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Use a throwaway pager on a copy of the tree so that the passed one isn't attached to the page file
+	p := &Pager{
+		end:    headerSize,
+		lru:    list.New(),
+		leaves: make(map[*Leaf]*page),
+	}
+	p.root = &Branch{
+		nature: copyNode(root),
+	}
+	var buf bytes.Buffer
+	offset, _, _, err := p.persist(p.root, &buf, true)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(buf.Bytes(), headerSize); err != nil {
+		return err
+	}
+	if err = writeHeader(f, initPrime, size, offset, headerSize+int64(buf.Len())); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// OpenPages returns the pager of the page file at the passed path, keeping at most `capacity` nodes and leaves in memory;
+// if the file doesn't exist, it's created with an empty tree using the passed initial prime
+func OpenPages(path string, initPrime uint64, capacity int) (p *Pager, err error) {
+	if _, e := os.Stat(path); os.IsNotExist(e) {
+		if err = CreatePages(path, NewNode(initPrime), initPrime, 0); err != nil {
+			return
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return
+	}
+	header := make([]byte, headerSize)
+	if _, err = f.ReadAt(header, 0); err != nil || string(header[:8]) != pageMagic {
+		f.Close()
+		return nil, errors.New("not a valid page file: " + path)
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	p = &Pager{
+		InitPrime: binary.BigEndian.Uint64(header[8:]),
+		path:      path,
+		Size:      binary.BigEndian.Uint64(header[16:]),
+		file:      f,
+		end:       int64(binary.BigEndian.Uint64(header[32:])),
+		lru:       list.New(),
+		leaves:    make(map[*Leaf]*page),
+		capacity:  capacity,
+	}
+	if err = p.mapping.remap(f, p.end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	rootPage := &page{
+		pager:  p,
+		kind:   kindNode,
+		offset: int64(binary.BigEndian.Uint64(header[24:])),
+	}
+	root, err := p.load(rootPage)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.root = &Branch{
+		nature: root,
+		page:   rootPage,
+	}
+	return
+}
+
+// copyNode returns a deep copy of the structure of the passed node, sharing its leaves
+func copyNode(n *Node) *Node {
+	copied := NewNode(n.StagePrime)
+	for i, b := range n.children {
+		switch content := b.get().(type) {
+		case *Leaf:
+			copied.children[i] = &Branch{nature: content}
+		case *Node:
+			copied.children[i] = &Branch{nature: copyNode(content)}
+		}
+	}
+	return copied
+}
+
+// decodeNode reads the stage prime and the non-empty children of the passed payload of a node record
+func decodeNode(payload []byte) (stagePrime uint64, entries []entry, err error) {
+	if len(payload) < 12 {
+		return 0, nil, errors.New("truncated node record")
+	}
+	count := int(binary.BigEndian.Uint32(payload[8:]))
+	if len(payload) != 12+count*13 {
+		return 0, nil, errors.New("truncated node record")
+	}
+	entries = make([]entry, count)
+	for i := range entries {
+		raw := payload[12+i*13:]
+		entries[i] = entry{
+			remainder: uint64(binary.BigEndian.Uint32(raw)),
+			kind:      raw[4],
+			offset:    int64(binary.BigEndian.Uint64(raw[5:])),
+		}
+	}
+	return binary.BigEndian.Uint64(payload), entries, nil
+}
+
+// encodeNode builds the payload of a node record with the passed stage prime and non-empty children, in increasing order of remainder
+func encodeNode(stagePrime uint64, entries []entry) []byte {
+	payload := make([]byte, 12+len(entries)*13)
+	binary.BigEndian.PutUint64(payload, stagePrime)
+	binary.BigEndian.PutUint32(payload[8:], uint32(len(entries)))
+	for i, e := range entries {
+		raw := payload[12+i*13:]
+		binary.BigEndian.PutUint32(raw, uint32(e.remainder))
+		raw[4] = e.kind
+		binary.BigEndian.PutUint64(raw[5:], uint64(e.offset))
+	}
+	return payload
+}
+
+func writeHeader(f *os.File, initPrime, size uint64, root, end int64) error {
+	header := make([]byte, headerSize)
+	copy(header, pageMagic)
+	binary.BigEndian.PutUint64(header[8:], initPrime)
+	binary.BigEndian.PutUint64(header[16:], size)
+	binary.BigEndian.PutUint64(header[24:], uint64(root))
+	binary.BigEndian.PutUint64(header[32:], uint64(end))
+	_, err := f.WriteAt(header, 0)
+	return err
+}
+
+var errDirty = errors.New("modified since the last flush")
@@ -0,0 +1,459 @@
+package index
+
+import (
+	"encoding/base64"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+// Orders of the subchains listed by `Chains()`
+const (
+	ORIGIN_ORDER = "origin"
+	LENGTH_ORDER = "length"
+	RECENT_ORDER = "recent"
+)
+
+// compactionThreshold is the number of empty slots a subchain may have beyond the number of its items before being compacted
+const compactionThreshold = 64
+
+//--- TYPES
+
+// Chain describes a subchain of the index, the segment and position of its last item telling how recently it was extended in the append-only data
+type Chain struct {
+	Origin       model.Hash `json:"origin"`
+	Tail         model.Hash `json:"tail"`
+	Length       int        `json:"length"`
+	TailSegment  int        `json:"tailSegment,omitempty"`
+	TailPosition int64      `json:"tailPosition"`
+}
+
+// chain holds the IDs of a subchain in the order they were appended, its origin first and the removed ones left empty until it's compacted,
+// along with a Fenwick tree counting the items left in its slots, so that the sequence number of an item and the item at a sequence number
+// are both found in logarithmic time
+type chain struct {
+	ids    model.Hashes
+	counts []int // The Fenwick tree, 1-based
+	length int
+}
+
+// sortedChains keeps the subchains sorted in each order until the next change of the index
+type sortedChains struct {
+	sync.Mutex
+	version uint64
+	lists   map[string][]Chain
+}
+
+//--- METHODS
+
+// Chains returns at most `limit` subchains (all of them if not positive) in the passed order, ie. by origin (the default), the longest
+// or the most recently extended first, ties being sorted by origin, starting right after the passed opaque cursor (or from the beginning
+// if empty), along with the cursor to pass to get the next ones (empty when done).
+//
+// The cursor holds the sort key of the last subchain along with its origin, so that the next page starts where the previous one ended
+// even if this subchain was removed in the meantime; a subchain whose sort key changed between two pages could still be skipped or listed twice.
+// The sorted list is kept until the next change of the index.
+func (t *Treee) Chains(order, cursor string, limit int) (chains []Chain, next string, err error) {
+	if order == "" {
+		order = ORIGIN_ORDER
+	}
+	var less func(a, b *Chain) bool
+	switch order {
+	case ORIGIN_ORDER:
+		less = func(a, b *Chain) bool {
+			return a.Origin < b.Origin
+		}
+	case LENGTH_ORDER:
+		less = func(a, b *Chain) bool {
+			if a.Length != b.Length {
+				return a.Length > b.Length
+			}
+			return a.Origin < b.Origin
+		}
+	case RECENT_ORDER:
+		less = func(a, b *Chain) bool {
+			if a.TailSegment != b.TailSegment {
+				return a.TailSegment > b.TailSegment
+			}
+			if a.TailPosition != b.TailPosition {
+				return a.TailPosition > b.TailPosition
+			}
+			return a.Origin < b.Origin
+		}
+	default:
+		return nil, "", exception.NewInvalidSortError(order)
+	}
+	var after *Chain
+	if cursor != "" {
+		if after, err = parseChainCursor(order, cursor); err != nil {
+			return
+		}
+	}
+
+	all := t.sortChains(order, less)
+	start := 0
+	if after != nil {
+		start = sort.Search(len(all), func(i int) bool {
+			return less(after, &all[i])
+		})
+	}
+	end := len(all)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	// The sorted list is shared by the next calls
+	chains = append([]Chain{}, all[start:end]...)
+	if end < len(all) {
+		next = chainCursor(order, &all[end-1])
+	}
+	return
+}
+
+// ChainLength returns the number of items in the subchain of the passed ID
+func (t *Treee) ChainLength(id model.Hash) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	found, err := t.search(id)
+	if err != nil {
+		return 0, err
+	}
+	c, ok := t.chains[found.Origin]
+	if !ok {
+		originStr, _ := found.Origin.String()
+		return 0, exception.NewNotFoundError(originStr)
+	}
+	return c.length, nil
+}
+
+// Distance returns the number of steps to go from `a` to `b` in their subchain, negative if `b` comes before `a`
+func (t *Treee) Distance(a, b model.Hash) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	first, err := t.search(a)
+	if err != nil {
+		return 0, err
+	}
+	second, err := t.search(b)
+	if err != nil {
+		return 0, err
+	}
+	if first.Origin != second.Origin {
+		aStr, _ := first.ID.String()
+		bStr, _ := second.ID.String()
+		return 0, exception.NewNotInSameChainError(aStr, bStr)
+	}
+	seqA, okA := t.sequence(first)
+	seqB, okB := t.sequence(second)
+	if !okA || !okB {
+		aStr, _ := first.ID.String()
+		bStr, _ := second.ID.String()
+		return 0, exception.NewNotInSameChainError(aStr, bStr)
+	}
+	return seqB - seqA, nil
+}
+
+// IndexInChain returns the sequence number of the passed ID in its subchain, `0` being the origin
+func (t *Treee) IndexInChain(id model.Hash) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	found, err := t.search(id)
+	if err != nil {
+		return 0, err
+	}
+	seq, ok := t.sequence(found)
+	if !ok {
+		idStr, _ := found.ID.String()
+		return 0, exception.NewNotFoundError(idStr)
+	}
+	return seq, nil
+}
+
+// Nth returns the item at the passed sequence number in the subchain of the passed ID, `0` being the origin
+func (t *Treee) Nth(origin model.Hash, n int) (*branch.Leaf, error) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	found, err := t.search(origin)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := t.chains[found.Origin]
+	if !ok {
+		originStr, _ := found.Origin.String()
+		return nil, exception.NewNotFoundError(originStr)
+	}
+	if n < 0 || n >= c.length {
+		return nil, exception.NewOutOfRangeError(n, c.length)
+	}
+	return t.search(c.ids[c.find(n)])
+}
+
+// Origins lists all the subchains of the index sorted by origin ID
+func (t *Treee) Origins() []Chain {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	return t.origins()
+}
+
+func (t *Treee) origins() []Chain {
+	chains := make([]Chain, 0, len(t.chains))
+	for originID, c := range t.chains {
+		tail, err := t.search(c.ids[c.find(c.length-1)])
+		if err != nil {
+			continue
+		}
+		originStr, _ := originID.String()
+		tailStr, _ := tail.ID.String()
+		chains = append(chains, Chain{
+			Origin:       model.Hash(originStr),
+			Tail:         model.Hash(tailStr),
+			Length:       c.length,
+			TailSegment:  tail.Segment,
+			TailPosition: tail.Position,
+		})
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].Origin < chains[j].Origin
+	})
+	return chains
+}
+
+// SameChain returns `true` if both passed IDs belong to the same subchain
+func (t *Treee) SameChain(a, b model.Hash) (bool, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	first, err := t.search(a)
+	if err != nil {
+		return false, err
+	}
+	second, err := t.search(b)
+	if err != nil {
+		return false, err
+	}
+	return first.Origin == second.Origin, nil
+}
+
+// chainAdd appends the passed leaf to its subchain right after its previous item
+func (t *Treee) chainAdd(leaf *branch.Leaf) {
+	if t.chains == nil {
+		t.chains = make(map[model.Hash]*chain)
+		t.slots = make(map[model.Hash]int)
+	}
+	if leaf.Origin == leaf.ID {
+		c := &chain{}
+		t.slots[leaf.ID] = c.append(leaf.ID)
+		t.chains[leaf.ID] = c
+		return
+	}
+	c, ok := t.chains[leaf.Origin]
+	if !ok {
+		return
+	}
+	if slot, ok := t.slots[leaf.Previous]; ok && slot < len(c.ids)-1 {
+		// Like in the linked list, the items after the previous one are dropped from the subchain
+		for _, dropped := range c.ids[slot+1:] {
+			delete(t.slots, dropped)
+		}
+		c.truncate(slot)
+	}
+	t.slots[leaf.ID] = c.append(leaf.ID)
+}
+
+// chainRemove takes the passed leaf out of its subchain
+func (t *Treee) chainRemove(leaf *branch.Leaf) {
+	c, ok := t.chains[leaf.Origin]
+	if !ok {
+		return
+	}
+	slot, ok := t.slots[leaf.ID]
+	if !ok {
+		return
+	}
+	delete(t.slots, leaf.ID)
+	c.remove(slot)
+	if c.length == 0 {
+		delete(t.chains, leaf.Origin)
+	} else if len(c.ids) > 2*c.length+compactionThreshold {
+		// Amortized over the removals that left the slots empty
+		compacted := &chain{}
+		for _, id := range c.ids {
+			if id.NonEmpty() {
+				t.slots[id] = compacted.append(id)
+			}
+		}
+		*c = *compacted
+	}
+}
+
+// sortChains returns the subchains sorted with the passed function, which mustn't be modified, sorting them only if the index changed
+// since the last call for this order
+func (t *Treee) sortChains(order string, less func(a, b *Chain) bool) []Chain {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	t.sorted.Lock()
+	defer t.sorted.Unlock()
+	if t.sorted.lists == nil || t.sorted.version != t.changes {
+		t.sorted.lists = make(map[string][]Chain)
+		t.sorted.version = t.changes
+	}
+	if list, ok := t.sorted.lists[order]; ok {
+		return list
+	}
+	list := t.origins()
+	sort.SliceStable(list, func(i, j int) bool {
+		return less(&list[i], &list[j])
+	})
+	t.sorted.lists[order] = list
+	return list
+}
+
+// indexChains builds the subchains from the content of the tree
+func (t *Treee) indexChains() {
+	t.changes++
+	t.chains = make(map[model.Hash]*chain)
+	t.slots = make(map[model.Hash]int)
+	t.trunk.Walk(func(leaf *branch.Leaf) bool {
+		if leaf.Origin != leaf.ID {
+			return true
+		}
+		subchain, err := t.line(leaf.ID)
+		if err != nil {
+			return true
+		}
+		c := &chain{}
+		for _, item := range subchain {
+			t.slots[item.ID] = c.append(item.ID)
+		}
+		t.chains[leaf.ID] = c
+		return true
+	})
+}
+
+// sequence returns the sequence number of the passed leaf in its subchain
+func (t *Treee) sequence(leaf *branch.Leaf) (int, bool) {
+	c, ok := t.chains[leaf.Origin]
+	if !ok {
+		return 0, false
+	}
+	slot, ok := t.slots[leaf.ID]
+	if !ok {
+		return 0, false
+	}
+	return c.count(slot) - 1, true
+}
+
+// append adds the passed ID at the end of the subchain, returning its slot
+func (c *chain) append(id model.Hash) int {
+	if len(c.counts) == 0 {
+		c.counts = []int{0}
+	}
+	c.ids = append(c.ids, id)
+	i := len(c.ids)
+	// The new node of the Fenwick tree covers the slots (i - lowbit(i), i]
+	c.counts = append(c.counts, 1+c.prefix(i-1)-c.prefix(i-i&-i))
+	c.length++
+	return i - 1
+}
+
+// count returns the number of items in the slots up to the passed one, included
+func (c *chain) count(slot int) int {
+	return c.prefix(slot + 1)
+}
+
+// find returns the slot of the item at the passed sequence number, which must be in range
+func (c *chain) find(n int) int {
+	pos, rest := 0, n+1
+	for step := bits.Len(uint(len(c.counts) - 1)); step >= 0; step-- {
+		next := pos + 1<<step
+		if next < len(c.counts) && c.counts[next] < rest {
+			pos = next
+			rest -= c.counts[next]
+		}
+	}
+	return pos
+}
+
+func (c *chain) prefix(i int) (sum int) {
+	for ; i > 0; i -= i & -i {
+		sum += c.counts[i]
+	}
+	return
+}
+
+// remove empties the passed slot
+func (c *chain) remove(slot int) {
+	c.ids[slot] = model.EmptyHash
+	for i := slot + 1; i < len(c.counts); i += i & -i {
+		c.counts[i]--
+	}
+	c.length--
+}
+
+// truncate drops the slots after the passed one, the nodes of the Fenwick tree left only covering the slots kept
+func (c *chain) truncate(slot int) {
+	c.ids = c.ids[:slot+1]
+	c.counts = c.counts[:slot+2]
+	c.length = c.prefix(slot + 1)
+}
+
+//--- FUNCTIONS
+
+// chainCursor returns the cursor of the passed subchain, ie. its sort key in the passed order and its origin
+func chainCursor(order string, c *Chain) string {
+	var key string
+	switch order {
+	case LENGTH_ORDER:
+		key = strconv.Itoa(c.Length) + ":"
+	case RECENT_ORDER:
+		key = strconv.Itoa(c.TailSegment) + ":" + strconv.FormatInt(c.TailPosition, 10) + ":"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(key + string(c.Origin)))
+}
+
+// parseChainCursor returns the subchain a cursor in the passed order stands for, with the fields it's sorted by
+func parseChainCursor(order, cursor string) (*Chain, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, exception.NewInvalidCursorError(cursor)
+	}
+	parts := strings.Split(string(bytes), ":")
+	c := &Chain{
+		Origin: model.Hash(parts[len(parts)-1]),
+	}
+	if _, e := c.Origin.String(); e != nil || c.Origin.IsEmpty() {
+		return nil, exception.NewInvalidCursorError(cursor)
+	}
+	switch {
+	case order == ORIGIN_ORDER && len(parts) == 1:
+	case order == LENGTH_ORDER && len(parts) == 2:
+		c.Length, err = strconv.Atoi(parts[0])
+	case order == RECENT_ORDER && len(parts) == 3:
+		if c.TailSegment, err = strconv.Atoi(parts[0]); err == nil {
+			c.TailPosition, err = strconv.ParseInt(parts[1], 10, 64)
+		}
+	default:
+		err = exception.NewInvalidCursorError(cursor)
+	}
+	if err != nil {
+		return nil, exception.NewInvalidCursorError(cursor)
+	}
+	return c, nil
+}
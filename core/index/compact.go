@@ -0,0 +1,180 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+const (
+	// CHAIN_ORDER writes the items of each subchain next to each other in the compacted file, the subchains following the position of their origin
+	CHAIN_ORDER = "chain"
+	// FILE_ORDER keeps the items in the order of the original file
+	FILE_ORDER = "file"
+
+	// PENDING_SUFFIX is appended to the paths of the files being written by a compaction until they replace the original ones
+	PENDING_SUFFIX = ".compacting"
+)
+
+//--- TYPES
+
+// Relocation is the move of an item from its position in the original data to its position in the compacted file
+type Relocation struct {
+	ID          model.Hash `json:"id"`
+	FromSegment int        `json:"fromSegment,omitempty"`
+	From        int64      `json:"from"`
+	To          int64      `json:"to"`
+}
+
+//--- METHODS
+
+// Compact writes the content of all the items of the index to the passed writer in the passed order (`CHAIN_ORDER` or `FILE_ORDER`),
+// leaving out the bytes of removed items and unclaimed regions, and returns the map of their old positions to the new ones;
+// each item is framed by the passed encoder (see `data.NewEncoder()`) for the compacted file to be decoded as the original one,
+// or written as is if it's nil. The index itself is left untouched until the relocations are passed to `Relocate()`
+func (t *Treee) Compact(source data.Source, w io.Writer, order string, encoder data.RecordEncoder) ([]Relocation, error) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	// Only the IDs are listed, for a paged index not to keep all its leaves in memory
+	var ids []model.Hash
+	switch order {
+	case FILE_ORDER, "":
+		ids = make([]model.Hash, len(t.positions))
+		for i, item := range t.positions {
+			ids[i] = item.ID
+		}
+	case CHAIN_ORDER:
+		origins := make([]located, 0, len(t.chains))
+		for originID := range t.chains {
+			if origin, err := t.search(originID); err == nil {
+				origins = append(origins, locate(origin))
+			}
+		}
+		sort.Slice(origins, func(i, j int) bool {
+			return origins[i].isBefore(origins[j].Segment, origins[j].Position)
+		})
+		ids = make([]model.Hash, 0, len(t.positions))
+		written := make(map[model.Hash]bool, len(t.positions))
+		for _, origin := range origins {
+			subchain, err := t.line(origin.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, leaf := range subchain {
+				if !written[leaf.ID] {
+					ids = append(ids, leaf.ID)
+					written[leaf.ID] = true
+				}
+			}
+		}
+		// Items that can't be reached from their origin any more are kept in file order
+		for _, item := range t.positions {
+			if !written[item.ID] {
+				ids = append(ids, item.ID)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compaction order: %s", order)
+	}
+
+	relocations := make([]Relocation, 0, len(ids))
+	position := int64(0)
+	for _, id := range ids {
+		leaf, err := t.search(id)
+		if err != nil {
+			return nil, err
+		}
+		section, err := LeafReader(leaf, source)
+		if err != nil {
+			return nil, err
+		}
+		header, written := int64(0), leaf.Size
+		if encoder != nil {
+			header, written, err = encoder(w, section, leaf.Size)
+		} else {
+			_, err = io.Copy(w, section)
+		}
+		if err != nil {
+			return nil, err
+		}
+		idStr, _ := leaf.ID.String()
+		relocations = append(relocations, Relocation{
+			ID:          model.Hash(idStr),
+			FromSegment: leaf.Segment,
+			From:        leaf.Position,
+			To:          position + header,
+		})
+		position += written
+	}
+	return relocations, nil
+}
+
+// Relocate moves all the passed items to their new position in the first segment at once, after checking that none of them moved since
+// the relocations were computed (returning a `StaleRelocationError` otherwise, without changing anything);
+// since positions aren't part of the running digest of subchains, hash chaining is unaffected
+func (t *Treee) Relocate(relocations []Relocation) error {
+	t.Lock()
+	defer t.Unlock()
+	defer t.hold()()
+
+	if t.readOnly {
+		return exception.NewReadOnlyError()
+	}
+
+	leaves := make([]*branch.Leaf, len(relocations))
+	for i, relocation := range relocations {
+		found, err := t.search(relocation.ID)
+		if err != nil {
+			return err
+		}
+		if found.Segment != relocation.FromSegment || found.Position != relocation.From {
+			idStr, _ := found.ID.String()
+			return exception.NewStaleRelocationError(idStr)
+		}
+		leaves[i] = found
+	}
+	for i, leaf := range leaves {
+		leaf.Segment = 0
+		leaf.Position = relocations[i].To
+	}
+	if !t.pendingIndexes {
+		t.indexPositions()
+	}
+	t.touch(leaves...)
+	t.mirror()
+	return nil
+}
+
+//--- FUNCTIONS
+
+// FinishCompaction completes the switchover to the compacted data file and index if a compaction was interrupted by a crash, returning `true` if so.
+//
+// A compaction first writes the compacted data, then the offset of the follower (if any), and the index last, all with the `PENDING_SUFFIX`:
+// once the pending index exists, every file is complete and the compaction only has to replace the original ones, the index last,
+// then remove the delta snapshots of the former index; otherwise, it's discarded.
+func FinishCompaction(indexPath, dataPath string) (bool, error) {
+	pending := []string{dataPath, indexPath + ".offset", indexPath}
+	if _, err := os.Stat(indexPath + PENDING_SUFFIX); os.IsNotExist(err) {
+		for _, path := range pending[:2] {
+			if err := os.Remove(path + PENDING_SUFFIX); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	for _, path := range pending {
+		if err := os.Rename(path+PENDING_SUFFIX, path); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	removeDeltas(indexPath)
+	return true, nil
+}
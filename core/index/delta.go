@@ -0,0 +1,296 @@
+package index
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/utils"
+)
+
+// DELTA_SUFFIX is appended to the path of a saved index, followed by the sequence number, to get the path of its delta snapshots
+const DELTA_SUFFIX = ".delta-"
+
+//--- TYPES
+
+type deltas struct {
+	sync.Mutex
+	every int    // The number of deltas written between two full snapshots
+	base  string // The SHA-256 hash of the full snapshot the deltas apply to, in hexadecimal, empty if none
+	count int    // The number of deltas written since the full snapshot
+}
+
+// deltaHeader is written in plain before the delta for a stale one, eg. left behind by a crash or encrypted with a former key,
+// to be skipped without decrypting it
+type deltaHeader struct {
+	Base string `json:"base"`
+	Seq  int    `json:"seq"`
+}
+
+// delta holds the leaves changed since the previous snapshot
+type delta struct {
+	Base    string        `json:"base"`
+	Seq     int           `json:"seq"`
+	Size    uint64        `json:"size"`
+	Leaves  []branch.Leaf `json:"leaves"`
+	Removed []model.Hash  `json:"removed"`
+}
+
+//--- METHODS
+
+// UseDeltas makes `Save()` only write the leaves changed since the previous snapshot to a new delta snapshot next to the index file
+// (see `DELTA_SUFFIX`), the whole index being written again as a new base every `every` deltas (never if not positive) and the deltas
+// of the previous base removed; the first save is always a full one, unless the index was loaded along with its deltas.
+//
+// Deltas are compressed and encrypted like the index file, and signed too if set by `UseSigning()`, but the page file and the store
+// aren't supported, and only the base snapshots are kept as generations (see `UseGenerations()`).
+func (t *Treee) UseDeltas(every int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.deltas = &deltas{
+		every: every,
+		base:  t.baseDigest,
+		count: t.deltaCount,
+	}
+	t.dirty = make(map[model.Hash]struct{})
+}
+
+// SaveDelta writes the leaves changed since the previous snapshot to the next delta of the index file at the passed path, or the whole index
+// if a new base is due, returning the number of bytes written; nothing is written if nothing changed
+func (t *Treee) SaveDelta(path string) (int, error) {
+	d := t.deltas
+	if d == nil {
+		return 0, errors.New("delta snapshots aren't activated")
+	}
+	d.Lock()
+	defer d.Unlock()
+
+	t.Lock()
+	if t.readOnly {
+		t.Unlock()
+		return 0, exception.NewReadOnlyError()
+	}
+	dirty := t.dirty
+	t.dirty = make(map[model.Hash]struct{})
+	if d.base != "" && (d.every <= 0 || d.count < d.every) && len(dirty) == 0 {
+		t.Unlock()
+		return 0, nil
+	}
+	if d.base == "" || (d.every > 0 && d.count >= d.every) {
+		// Changes made while the base is written are part of the next delta as well, which is harmless
+		t.Unlock()
+		n, digest, err := t.saveBase(path)
+		if err != nil {
+			t.restoreDirty(dirty)
+			return 0, err
+		}
+		d.base = hex.EncodeToString(digest)
+		d.count = 0
+		removeDeltas(path)
+		return n, nil
+	}
+
+	next := &delta{
+		Base: d.base,
+		Seq:  d.count + 1,
+		Size: t.size,
+	}
+	for id := range dirty {
+		if found, err := t.search(id); err == nil {
+			next.Leaves = append(next.Leaves, *found)
+		} else {
+			next.Removed = append(next.Removed, id)
+		}
+	}
+	key, compression, signingKey := t.key, t.compression, t.signingKey
+	t.Unlock()
+
+	sort.Slice(next.Leaves, func(i, j int) bool {
+		return next.Leaves[i].ID < next.Leaves[j].ID
+	})
+	sort.Slice(next.Removed, func(i, j int) bool {
+		return next.Removed[i] < next.Removed[j]
+	})
+	deltaPath := deltaPathOf(path, next.Seq)
+	counter := &countingWriter{}
+	h := sha256.New()
+	err := utils.WriteAtomically(deltaPath, func(w io.Writer) error {
+		counter.w = io.MultiWriter(w, h)
+		if err := json.NewEncoder(counter).Encode(deltaHeader{Base: next.Base, Seq: next.Seq}); err != nil {
+			return err
+		}
+		return encode(counter, key, compression, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(next)
+		})
+	})
+	if err == nil && signingKey != nil {
+		err = writeSignature(deltaPath, h.Sum(nil), signingKey)
+	}
+	if err != nil {
+		t.restoreDirty(dirty)
+		return 0, err
+	}
+	d.count++
+	return counter.n, nil
+}
+
+// applyDeltas applies in order the deltas of the passed full snapshot saved next to it, keeping track of them for `UseDeltas()`;
+// if passed trusted keys, it checks the signature of each delta it applies, returning an `InvalidSignatureError` once all are applied
+// if any doesn't match
+func (t *Treee) applyDeltas(path, base string, key []byte, trusted []ed25519.PublicKey) error {
+	t.baseDigest = base
+	var unverified error
+	for seq := 1; ; seq++ {
+		deltaPath := deltaPathOf(path, seq)
+		var signature *Signature
+		if trusted != nil {
+			var err error
+			if signature, err = readSignature(deltaPath); err != nil {
+				if _, ok := err.(*exception.InvalidSignatureError); !ok {
+					return err
+				}
+			}
+		}
+		next, digest, err := readDelta(deltaPath, key, deltaHeader{Base: base, Seq: seq})
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			// Left behind by a crash right after a full snapshot
+			break
+		}
+		if trusted != nil && unverified == nil {
+			if signature == nil {
+				unverified = exception.NewInvalidSignatureError("missing signature file")
+			} else {
+				unverified = signature.verify(digest, trusted)
+			}
+		}
+		for _, id := range next.Removed {
+			if found, e := t.search(id); e == nil {
+				t.invalidate(id)
+				*found = *branch.NewEmptyLeaf()
+				t.size--
+			}
+		}
+		for i := range next.Leaves {
+			leaf := next.Leaves[i]
+			if found, e := t.search(leaf.ID); e == nil {
+				*found = leaf
+			} else if err = t.insert(&leaf); err != nil {
+				return err
+			} else {
+				t.size++
+			}
+		}
+		if t.size != next.Size {
+			return exception.NewIncoherentSizeError(int(next.Size), int(t.size))
+		}
+		t.deltaCount = seq
+	}
+	if t.deltaCount > 0 {
+		t.reindex()
+	}
+	return unverified
+}
+
+// markDirty marks the passed IDs as changed for the next delta snapshot, if activated
+func (t *Treee) markDirty(ids ...model.Hash) {
+	if t.dirty != nil {
+		for _, id := range ids {
+			t.dirty[id] = struct{}{}
+		}
+	}
+}
+
+// restoreDirty marks again the IDs of a delta snapshot that couldn't be written
+func (t *Treee) restoreDirty(dirty map[model.Hash]struct{}) {
+	t.Lock()
+	defer t.Unlock()
+
+	for id := range dirty {
+		t.dirty[id] = struct{}{}
+	}
+}
+
+//--- FUNCTIONS
+
+// DeltaPaths returns the paths of the delta snapshots saved next to the index file at the passed path, in order
+func DeltaPaths(path string) []string {
+	var paths []string
+	for seq := 1; ; seq++ {
+		deltaPath := deltaPathOf(path, seq)
+		if _, err := os.Stat(deltaPath); err != nil {
+			return paths
+		}
+		paths = append(paths, deltaPath)
+	}
+}
+
+func deltaPathOf(path string, seq int) string {
+	return path + DELTA_SUFFIX + fmt.Sprintf("%06d", seq)
+}
+
+// readDelta returns the delta snapshot at the passed path along with the SHA-256 hash of its file, or `nil` if its header doesn't match
+// the passed one
+func readDelta(path string, key []byte, expected deltaHeader) (*delta, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	buffered := bufio.NewReader(io.TeeReader(f, h))
+	line, err := buffered.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	var header deltaHeader
+	if json.Unmarshal(line, &header) != nil || header != expected {
+		return nil, nil, nil
+	}
+	plain, _, err := decrypted(buffered, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, _, err := decompressor(plain)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	var d delta
+	if err = json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, nil, err
+	}
+	if d.Base != header.Base || d.Seq != header.Seq {
+		return nil, nil, errors.New("delta not matching its header")
+	}
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, nil, err
+	}
+	return &d, h.Sum(nil), nil
+}
+
+// removeDeltas removes all the delta snapshots saved next to the index file at the passed path, along with their signature
+func removeDeltas(path string) {
+	matches, _ := filepath.Glob(path + DELTA_SUFFIX + "*")
+	for _, match := range matches {
+		_ = os.Remove(match)
+	}
+}
@@ -0,0 +1,259 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cyrildever/treee/core/exception"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	encryptionMagic = "TREEENC2"
+	chunkSize       = 64 * 1024
+	keyIDSize       = 8
+	saltSize        = 32
+	subkeyInfo      = "treee index encryption"
+)
+
+//--- TYPES
+
+// encryptor encrypts what's written to it chunk by chunk with AES-GCM, each chunk being authenticated along with its sequence number and
+// whether it's the last one, so that chunks can't be reordered, dropped or truncated without `decryptor` noticing.
+// Each file is encrypted with its own subkey derived from the key and a random salt, so that nonces never repeat however many files are saved.
+type encryptor struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	seq    uint32
+	buf    []byte
+}
+
+// decryptor reads what an `encryptor` wrote
+type decryptor struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	seq    uint32
+	buf    []byte
+	done   bool
+}
+
+//--- METHODS
+
+// UseEncryption encrypts the file written by `Save()` and `SaveAs()` with AES-GCM using the passed 16, 24 or 32-byte key (see `ParseKey()`);
+// passing `nil` deactivates it, and a loaded index keeps the key its file was decrypted with
+func (t *Treee) UseEncryption(key []byte) error {
+	if key != nil {
+		if _, err := newAEAD(key); err != nil {
+			return err
+		}
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	t.key = key
+	return nil
+}
+
+func (e *encryptor) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == chunkSize && len(p) > 0 {
+			// The last chunk is only written on closing
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last chunk, which may be empty
+func (e *encryptor) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptor) seal(last bool) error {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	sealed := e.aead.Seal(nil, nonce(e.seq, flag), e.buf, e.header)
+	frame := make([]byte, 5, 5+len(sealed))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(sealed)))
+	if _, err := e.w.Write(append(frame, sealed...)); err != nil {
+		return err
+	}
+	e.seq++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (d *decryptor) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk
+func (d *decryptor) open() error {
+	frame := make([]byte, 5)
+	if _, err := io.ReadFull(d.r, frame); err != nil {
+		return errors.New("truncated encrypted index")
+	}
+	flag := frame[0]
+	length := binary.BigEndian.Uint32(frame[1:])
+	if flag > 1 || length > chunkSize+uint32(d.aead.Overhead()) {
+		return errors.New("corrupted encrypted index")
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return errors.New("truncated encrypted index")
+	}
+	opened, err := d.aead.Open(sealed[:0], nonce(d.seq, flag), sealed, d.header)
+	if err != nil {
+		return fmt.Errorf("corrupted encrypted index: chunk %d failed authentication", d.seq)
+	}
+	d.seq++
+	d.buf = opened
+	d.done = flag == 1
+	return nil
+}
+
+//--- FUNCTIONS
+
+// GenerateKey returns a new random 32-byte key for `UseEncryption()`
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// ParseKey returns the key in the passed content, eg. of a key file or an environment variable, either raw or encoded in hexadecimal or base64
+func ParseKey(content []byte) ([]byte, error) {
+	trimmed := string(bytes.TrimSpace(content))
+	if key, err := hex.DecodeString(trimmed); err == nil && validKeySize(key) {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(trimmed); err == nil && validKeySize(key) {
+		return key, nil
+	}
+	if validKeySize(content) {
+		return content, nil
+	}
+	return nil, errors.New("invalid key: a 16, 24 or 32-byte key is expected, raw or encoded in hexadecimal or base64")
+}
+
+// encrypted returns the writer encrypting to the passed one with the passed key, to be closed once done
+func encrypted(w io.Writer, key []byte) (io.WriteCloser, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newFileAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(encryptionMagic), keyID(key)...), salt...)
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptor{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// decrypted returns the reader decrypting the passed one with the passed key if it starts with the magic bytes of an encrypted index,
+// or a reader of its plain content otherwise, along with whether it's encrypted; it returns a `WrongKeyError` if it was encrypted with
+// another key or if no key was passed
+func decrypted(r io.Reader, key []byte) (io.Reader, bool, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(len(encryptionMagic))
+	if string(magic) != encryptionMagic {
+		if bytes.HasPrefix(magic, []byte(encryptionMagic[:len(encryptionMagic)-1])) {
+			return nil, true, fmt.Errorf("unsupported version of encrypted index: %s", magic)
+		}
+		return buffered, false, nil
+	}
+	header := make([]byte, len(encryptionMagic)+keyIDSize+saltSize)
+	if _, err := io.ReadFull(buffered, header); err != nil {
+		return nil, true, errors.New("truncated encrypted index")
+	}
+	if key == nil {
+		return nil, true, exception.NewWrongKeyError("the index is encrypted but no key was passed")
+	}
+	if !bytes.Equal(header[len(encryptionMagic):len(encryptionMagic)+keyIDSize], keyID(key)) {
+		return nil, true, exception.NewWrongKeyError("the index was encrypted with another key")
+	}
+	aead, err := newFileAEAD(key, header[len(header)-saltSize:])
+	if err != nil {
+		return nil, true, err
+	}
+	return &decryptor{
+		r:      buffered,
+		aead:   aead,
+		header: header,
+	}, true, nil
+}
+
+// keyID returns the fingerprint of the passed key stored in the header of an encrypted index
+func keyID(key []byte) []byte {
+	hash := sha256.Sum256(append([]byte(encryptionMagic), key...))
+	return hash[:keyIDSize]
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newFileAEAD returns the cipher of a file, whose subkey is derived from the passed key and the random salt of the file with HKDF-SHA256
+func newFileAEAD(key, salt []byte) (cipher.AEAD, error) {
+	subkey := make([]byte, len(key))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(subkeyInfo)), subkey); err != nil {
+		return nil, err
+	}
+	return newAEAD(subkey)
+}
+
+// nonce returns the 12-byte nonce of a chunk made of zeros, the sequence number of the chunk and whether it's the last one,
+// which is unique since the subkey is specific to the file
+func nonce(seq uint32, flag byte) []byte {
+	n := make([]byte, 7, 12)
+	n = binary.BigEndian.AppendUint32(n, seq)
+	return append(n, flag)
+}
+
+func validKeySize(key []byte) bool {
+	return len(key) == 16 || len(key) == 24 || len(key) == 32
+}
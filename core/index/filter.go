@@ -0,0 +1,59 @@
+package index
+
+import (
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/utils/bloom"
+)
+
+// minFilterCapacity is the minimum number of items the Bloom filter is sized for
+const minFilterCapacity = 1024
+
+//--- METHODS
+
+// UseFilter maintains a Bloom filter of the indexed IDs with the passed false-positive rate (eg. `0.01`), so that looking for an ID that was
+// never indexed doesn't need to walk the tree most of the time; passing `0` deactivates it.
+//
+// NB: IDs can't be taken out of a Bloom filter, so removed items remain false positives until the filter gets rebuilt, ie. when it's full
+// or when the index is loaded again.
+func (t *Treee) UseFilter(falsePositiveRate float64) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.falsePositiveRate = falsePositiveRate
+	if falsePositiveRate <= 0 {
+		t.filter = nil
+		return
+	}
+	t.indexFilter()
+}
+
+// filterAdd adds the passed leaf to the Bloom filter, resizing it once full to keep the false-positive rate
+func (t *Treee) filterAdd(leaf *branch.Leaf) {
+	if t.filter.Count() >= t.filter.Capacity() {
+		t.indexFilter()
+		return
+	}
+	if idStr, err := leaf.ID.String(); err == nil {
+		t.filter.Add([]byte(idStr))
+	}
+}
+
+// mayContain returns `false` if the passed ID is known not to be in the index
+func (t *Treee) mayContain(idStr string) bool {
+	return t.filter == nil || t.filter.MayContain([]byte(idStr))
+}
+
+// indexFilter builds the Bloom filter from the content of the tree, sized for twice its current size
+func (t *Treee) indexFilter() {
+	capacity := 2 * t.size
+	if capacity < minFilterCapacity {
+		capacity = minFilterCapacity
+	}
+	t.filter = bloom.New(capacity, t.falsePositiveRate)
+	t.trunk.Walk(func(leaf *branch.Leaf) bool {
+		if idStr, err := leaf.ID.String(); err == nil {
+			t.filter.Add([]byte(idStr))
+		}
+		return true
+	})
+}
@@ -0,0 +1,328 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/utils"
+)
+
+// DEFAULT_COMMIT_INTERVAL is the minimum time between two saves of the index by its follower, unless set by `UseCommitInterval()`
+const DEFAULT_COMMIT_INTERVAL = 10 * time.Second
+
+//--- TYPES
+
+// Follower tails the immutable data, decoding the records appended to it and adding them to the index;
+// if the data rotates into segment files, it moves on to the next segment as soon as it's created
+type Follower struct {
+	treee       *Treee
+	dataPath    string
+	decoderName string
+	hasher      data.Hasher
+	indexPath   string
+	offsetPath  string
+
+	mu          sync.Mutex
+	file        *os.File
+	segment     int
+	offset      int64
+	pending     bool // Set when the records indexed up to the offset aren't saved yet
+	committed   time.Time
+	commitEvery time.Duration
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+//--- METHODS
+
+// Follow returns a follower of the passed data file, or pattern of segment files (see `data.IsPattern()`), resuming from the offset
+// saved along the index file, if any; when `indexPath` is empty, the index isn't saved and the whole data is indexed again at each start.
+// For a paged index (see `OpenPaged()`), `indexPath` should be the path to the page file, which gets flushed instead of saving the index;
+// for an index mirrored to a store (see `UseStore()`), it's only used for the offset file, written once the store caught up with the index.
+func (t *Treee) Follow(dataPath, decoderName string, hasher data.Hasher, indexPath string) (*Follower, error) {
+	if _, err := data.NewDecoder(decoderName, strings.NewReader(""), 0, hasher); err != nil {
+		return nil, err
+	}
+	f := &Follower{
+		treee:       t,
+		dataPath:    dataPath,
+		decoderName: decoderName,
+		hasher:      hasher,
+		indexPath:   indexPath,
+		commitEvery: DEFAULT_COMMIT_INTERVAL,
+	}
+	if indexPath != "" {
+		f.offsetPath = indexPath + ".offset"
+		segment, offset, err := readOffset(f.offsetPath)
+		if err != nil {
+			return nil, err
+		}
+		f.segment = segment
+		f.offset = offset
+		t.setFollowed(segment, offset)
+	}
+	file, err := os.Open(data.SegmentPath(f.dataPath, f.segment))
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	return f, nil
+}
+
+// Offset returns the segment and the position in it right after the last indexed record
+func (f *Follower) Offset() (segment int, offset int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.segment, f.offset
+}
+
+// Poll indexes the complete records appended to the data since the last call, returning the number of items added;
+// items already in the index are skipped, so that records indexed right before a crash are not a problem upon restart,
+// and so are the records that can't be indexed (eg. with an unknown previous item or overlapping another one) after being logged.
+// The index is saved, then the offset, at most every commit interval (see `UseCommitInterval()`) and before moving on to the next segment.
+func (f *Follower) Poll() (added int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		// The writer only creates the next segment once done with the current one
+		next := data.SegmentPath(f.dataPath, f.segment+1)
+		_, e := os.Stat(next)
+		rotated := data.IsPattern(f.dataPath) && e == nil
+
+		// The last record of a closed segment needs no trailing newline
+		n, size, e := f.pollSegment(rotated)
+		added += n
+		if e != nil {
+			err = e
+			return
+		}
+		if !rotated {
+			err = f.commit(false)
+			return
+		}
+		if f.offset < size {
+			err = fmt.Errorf("incomplete record at the end of segment %d: %d < %d", f.segment, f.offset, size)
+			return
+		}
+		file, e := os.Open(next)
+		if e != nil {
+			err = e
+			return
+		}
+		if e := f.commit(true); e != nil {
+			file.Close()
+			err = e
+			return
+		}
+		if f.offsetPath != "" {
+			if e := writeOffset(f.offsetPath, f.segment+1, 0); e != nil {
+				file.Close()
+				err = e
+				return
+			}
+			f.treee.setFollowed(f.segment+1, 0)
+		}
+		f.file.Close()
+		f.file = file
+		f.segment++
+		f.offset = 0
+	}
+}
+
+// Start polls the data at the passed interval in the background until `Stop()` is called
+func (f *Follower) Start(interval time.Duration) {
+	log := logger.Init("index", "Follow")
+
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+	go func() {
+		defer close(f.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			added, err := f.Poll()
+			segment, offset := f.Offset()
+			if err != nil {
+				log.Error("Unable to index new records", "error", err, "segment", segment, "offset", offset)
+			} else if added > 0 {
+				log.Info("New records indexed", "added", added, "segment", segment, "offset", offset)
+			}
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the current poll to end, saves what it indexed since the last commit and stops following the data
+func (f *Follower) Stop() {
+	if f.stop != nil {
+		close(f.stop)
+		<-f.done
+		f.stop = nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.commit(true); err != nil {
+		log := logger.Init("index", "Follow")
+		log.Error("Unable to save indexed records", "error", err, "segment", f.segment, "offset", f.offset)
+	}
+	f.file.Close()
+}
+
+// UseCommitInterval sets the minimum time between two saves of the index by the follower, each one being followed by the write of the offset
+// (see `DEFAULT_COMMIT_INTERVAL`); the records indexed in between are indexed again after a crash, which skips them
+func (f *Follower) UseCommitInterval(interval time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commitEvery = interval
+}
+
+// pollSegment indexes the complete records appended to the current segment, or all of them if `final`, returning the number of items added
+// and the size of the segment
+func (f *Follower) pollSegment(final bool) (added int, size int64, err error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	size = info.Size()
+	if size < f.offset {
+		err = fmt.Errorf("data file shrunk below the last indexed offset: %d < %d", size, f.offset)
+		return
+	}
+	if size == f.offset {
+		return
+	}
+
+	newDecoder := data.NewDecoder
+	if final {
+		newDecoder = data.NewFinalDecoder
+	}
+	decoder, err := newDecoder(f.decoderName, io.NewSectionReader(f.file, f.offset, size-f.offset), f.offset, f.hasher)
+	if err != nil {
+		return
+	}
+	log := logger.Init("index", "Follow")
+	indexed := f.offset
+	for {
+		record, e := decoder.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			// The record will be decoded again at the next call
+			err = e
+			break
+		}
+		e = f.treee.Add(branch.Leaf{
+			ID:       record.ID,
+			Segment:  f.segment,
+			Position: record.Position,
+			Size:     record.Size,
+			Previous: record.Previous,
+		})
+		if e == nil {
+			added++
+		} else if _, ok := e.(*exception.AlreadyExistsInIndexError); !ok {
+			// As when building the index, a record that can't be indexed is skipped for good
+			log.Warn("Unable to index record", "error", e, "segment", f.segment, "position", record.Position)
+		}
+		indexed = decoder.Offset()
+	}
+	if indexed > f.offset {
+		f.offset = indexed
+		f.pending = true
+	}
+	return
+}
+
+// commit makes the index durable up to the offset of the current segment before saving the latter, or a crash in between would lose records,
+// unless nothing is pending or, when not forced, the last commit is too recent; an index mirrored to its store is durable once the store
+// caught up with it
+func (f *Follower) commit(force bool) (err error) {
+	if !f.pending || f.indexPath == "" {
+		f.pending = false
+		return
+	}
+	if f.treee.store == nil && !force && time.Since(f.committed) < f.commitEvery {
+		return
+	}
+	// Saved along with the next generation, the index then holding every record up to there
+	f.treee.setFollowed(f.segment, f.offset)
+	if f.treee.IsPaged() {
+		err = f.treee.Flush()
+	} else if f.treee.store != nil {
+		err = f.treee.SyncStore()
+	} else {
+		_, err = f.treee.saveTo(f.indexPath)
+	}
+	if err != nil {
+		return
+	}
+	if err = writeOffset(f.offsetPath, f.segment, f.offset); err != nil {
+		return
+	}
+	f.pending = false
+	f.committed = time.Now()
+	return
+}
+
+// setFollowed sets the segment and offset of the data indexed by the follower, saved along with the next generation
+func (t *Treee) setFollowed(segment int, offset int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.followed = formatOffset(segment, offset)
+}
+
+//--- FUNCTIONS
+
+// formatOffset returns the content of the offset file for the passed segment and offset, the former being omitted for the first segment
+func formatOffset(segment int, offset int64) string {
+	str := strconv.FormatInt(offset, 10)
+	if segment > 0 {
+		str = strconv.Itoa(segment) + ":" + str
+	}
+	return str
+}
+
+// readOffset returns the segment and offset saved in the passed file, or zeros if it doesn't exist
+func readOffset(path string) (segment int, offset int64, err error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	str := strings.TrimSpace(string(content))
+	if s, o, found := strings.Cut(str, ":"); found {
+		if segment, err = strconv.Atoi(s); err != nil {
+			return
+		}
+		str = o
+	}
+	offset, err = strconv.ParseInt(str, 10, 64)
+	return
+}
+
+// writeOffset atomically replaces the content of the passed file with the segment and offset (see `formatOffset()`)
+func writeOffset(path string, segment int, offset int64) error {
+	return utils.WriteFileAtomically(path, []byte(formatOffset(segment, offset)))
+}
@@ -0,0 +1,310 @@
+package index
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/utils"
+)
+
+// MANIFEST_FILE is the name of the file listing the snapshot generations in their directory
+const MANIFEST_FILE = "manifest.json"
+
+// DEFAULT_GENERATIONS is the number of most recent generations kept when the retention policy doesn't set any
+const DEFAULT_GENERATIONS = 10
+
+const generationLayout = "20060102T150405.000000000Z"
+
+//--- TYPES
+
+// Generation is a timestamped snapshot of the index saved in the directory set by `UseGenerations()`
+type Generation struct {
+	File   string    `json:"file"`             // The name of the snapshot file in the directory
+	Time   time.Time `json:"time"`             // When it was saved
+	Bytes  int64     `json:"bytes"`            // The size of the file
+	Leaves uint64    `json:"leaves"`           // The number of items in the index
+	Digest string    `json:"digest,omitempty"` // The SHA-256 hash of the file, in hexadecimal
+	Offset string    `json:"offset,omitempty"` // The segment and offset of the data indexed by its follower, if any, as in its offset file
+}
+
+// Retention tells which snapshot generations to keep, the latest one always being kept and the `DEFAULT_GENERATIONS` most recent ones
+// if nothing is set
+type Retention struct {
+	Last   int // The number of most recent generations to keep
+	Hourly int // The number of past hours to keep the latest generation of
+	Daily  int // The number of past days to keep the latest generation of
+}
+
+type generations struct {
+	sync.Mutex
+	dir       string
+	retention Retention
+	every     time.Duration // The minimum time between two generations
+}
+
+type manifest struct {
+	Generations []Generation `json:"generations"`
+}
+
+//--- METHODS
+
+// Keep returns the generations to keep among the passed ones, from the most recent to the oldest
+func (r Retention) Keep(all []Generation) []Generation {
+	sorted := append([]Generation{}, all...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.After(sorted[j].Time)
+	})
+	if r.Last <= 0 && r.Hourly <= 0 && r.Daily <= 0 {
+		r.Last = DEFAULT_GENERATIONS
+	}
+	hours := make(map[time.Time]bool)
+	days := make(map[string]bool)
+	var kept []Generation
+	for i, gen := range sorted {
+		keep := i == 0 || i < r.Last
+		if hour := gen.Time.UTC().Truncate(time.Hour); !hours[hour] && len(hours) < r.Hourly {
+			hours[hour] = true
+			keep = true
+		}
+		if day := gen.Time.UTC().Format("2006-01-02"); !days[day] && len(days) < r.Daily {
+			days[day] = true
+			keep = true
+		}
+		if keep {
+			kept = append(kept, gen)
+		}
+	}
+	return kept
+}
+
+// UseGenerations makes `Save()` write each snapshot of the index as a new timestamped generation in the passed directory, listed in its
+// manifest (see `MANIFEST_FILE`) and pruned according to the passed retention, the index file then being a hard link to the latest one.
+// At most one generation is written every passed interval (at each save if not positive), the saves in between only replacing the index file.
+func (t *Treee) UseGenerations(dir string, retention Retention, every time.Duration) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	t.generations = &generations{
+		dir:       dir,
+		retention: retention,
+		every:     every,
+	}
+	return nil
+}
+
+// SaveGeneration writes the index as a new generation in the directory set by `UseGenerations()` then points the passed index file at it,
+// unless empty, before removing the generations the retention policy doesn't keep
+func (t *Treee) SaveGeneration(path string) (*Generation, error) {
+	g := t.generations
+	if g == nil {
+		return nil, errors.New("snapshot generations aren't activated")
+	}
+	g.Lock()
+	defer g.Unlock()
+
+	all, err := Generations(g.dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if len(all) > 0 && !now.After(all[len(all)-1].Time) {
+		now = all[len(all)-1].Time.Add(time.Nanosecond)
+	}
+	t.RLock()
+	gen := Generation{
+		File:   GenerationFile(now),
+		Time:   now,
+		Leaves: t.size,
+		Offset: t.followed,
+	}
+	t.RUnlock()
+	genPath := filepath.Join(g.dir, gen.File)
+	n, digest, err := t.saveAs(genPath)
+	if err != nil {
+		return nil, err
+	}
+	gen.Bytes = int64(n)
+	gen.Digest = hex.EncodeToString(digest)
+	if path != "" {
+		if err = pointTo(path, genPath); err != nil {
+			return nil, err
+		}
+	}
+
+	kept := g.retention.Keep(append(all, gen))
+	keptFiles := make(map[string]bool, len(kept))
+	for _, k := range kept {
+		keptFiles[k.File] = true
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Time.Before(kept[j].Time)
+	})
+	// The manifest is written first so that it never lists a removed file
+	if err = writeManifest(g.dir, kept); err != nil {
+		return nil, err
+	}
+	for _, old := range all {
+		if !keptFiles[old.File] {
+			_ = os.Remove(filepath.Join(g.dir, old.File))
+			_ = os.Remove(filepath.Join(g.dir, old.File) + SIGNATURE_SUFFIX)
+		}
+	}
+	return &gen, nil
+}
+
+// due tells whether the minimum time between two generations has elapsed since the latest one
+func (g *generations) due() bool {
+	if g.every <= 0 {
+		return true
+	}
+	g.Lock()
+	defer g.Unlock()
+
+	all, err := Generations(g.dir)
+	if err != nil || len(all) == 0 {
+		// Any error is returned by `SaveGeneration()`
+		return true
+	}
+	return time.Since(all[len(all)-1].Time) >= g.every
+}
+
+// saveBase writes the whole index to the passed file, through a new generation if set by `UseGenerations()` and due, returning the number
+// of bytes written and the SHA-256 hash of the file
+func (t *Treee) saveBase(path string) (int, []byte, error) {
+	if t.generations == nil || !t.generations.due() {
+		// Replacing the index file leaves the generation it was a hard link to untouched
+		return t.saveAs(path)
+	}
+	gen, err := t.SaveGeneration(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	digest, _ := hex.DecodeString(gen.Digest)
+	return int(gen.Bytes), digest, nil
+}
+
+// saveTo saves the index to the passed file, as a delta if set by `UseDeltas()` and through a new generation if set by `UseGenerations()`,
+// returning the number of bytes written
+func (t *Treee) saveTo(path string) (int, error) {
+	// Concurrent saves, eg. by the follower and after an insertion, could otherwise leave the file of one next to the signature of the other
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	if t.deltas != nil {
+		return t.SaveDelta(path)
+	}
+	n, _, err := t.saveBase(path)
+	return n, err
+}
+
+//--- FUNCTIONS
+
+// GenerationFile returns the name of the snapshot file of a generation saved at the passed time
+func GenerationFile(at time.Time) string {
+	return "treee-" + at.UTC().Format(generationLayout) + ".json"
+}
+
+// GenerationTime returns the time a generation was saved at from the name of its snapshot file, or `false` if it's not one
+func GenerationTime(file string) (time.Time, bool) {
+	name := filepath.Base(file)
+	if !strings.HasPrefix(name, "treee-") || !strings.HasSuffix(name, ".json") {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(generationLayout, strings.TrimSuffix(strings.TrimPrefix(name, "treee-"), ".json"))
+	return at, err == nil
+}
+
+// Generations returns the snapshot generations listed in the manifest of the passed directory, from the oldest to the most recent
+func Generations(dir string) ([]Generation, error) {
+	content, err := os.ReadFile(filepath.Join(dir, MANIFEST_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err = json.Unmarshal(content, &m); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(m.Generations, func(i, j int) bool {
+		return m.Generations[i].Time.Before(m.Generations[j].Time)
+	})
+	return m.Generations, nil
+}
+
+// GenerationAt returns the most recent snapshot generation of the passed directory saved at or before the passed time,
+// or a `NoGenerationError` if there's none
+func GenerationAt(dir string, at time.Time) (*Generation, error) {
+	all, err := Generations(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		if !all[i].Time.After(at) {
+			return &all[i], nil
+		}
+	}
+	return nil, exception.NewNoGenerationError(at.UTC().Format(time.RFC3339Nano))
+}
+
+// RestoreGeneration points the passed index file at the most recent snapshot generation saved at or before the passed time, signature included,
+// removing the delta snapshots of the previous one.
+//
+// The offset of the follower of the data file is set back to the one saved along with the generation for the next start to resume
+// from there, or removed if there was none for it to index the data again from the beginning, the items already in the restored index
+// being skipped.
+func RestoreGeneration(dir string, at time.Time, path string) (*Generation, error) {
+	gen, err := GenerationAt(dir, at)
+	if err != nil {
+		return nil, err
+	}
+	if err = pointTo(path, filepath.Join(dir, gen.File)); err != nil {
+		return nil, err
+	}
+	if gen.Offset != "" {
+		err = utils.WriteFileAtomically(path+".offset", []byte(gen.Offset))
+	} else if err = os.Remove(path + ".offset"); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	removeDeltas(path)
+	return gen, nil
+}
+
+// pointTo makes the passed index file a hard link to the passed generation, or a copy of it, along with its signature if any
+func pointTo(path, genPath string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := utils.LinkAtomically(genPath, path); err != nil {
+		return err
+	}
+	if _, err := os.Stat(genPath + SIGNATURE_SUFFIX); err == nil {
+		return utils.LinkAtomically(genPath+SIGNATURE_SUFFIX, path+SIGNATURE_SUFFIX)
+	}
+	if err := os.Remove(path + SIGNATURE_SUFFIX); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func writeManifest(dir string, all []Generation) error {
+	content, err := json.MarshalIndent(manifest{Generations: all}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomically(filepath.Join(dir, MANIFEST_FILE), content)
+}
@@ -0,0 +1,44 @@
+package index
+
+import (
+	"io"
+
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+//--- METHODS
+
+// ItemReader returns a reader limited to the bytes of the passed item in its segment of the data
+func (t *Treee) ItemReader(id model.Hash, source data.Source) (*io.SectionReader, error) {
+	found, err := t.Search(id)
+	if err != nil {
+		return nil, err
+	}
+	return LeafReader(found, source)
+}
+
+// ReadItem reads the content of the passed item from its segment of the data
+func (t *Treee) ReadItem(id model.Hash, source data.Source) ([]byte, error) {
+	section, err := t.ItemReader(id, source)
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, section.Size())
+	if _, err = io.ReadFull(section, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+//--- FUNCTIONS
+
+// LeafReader returns a reader limited to the bytes of the passed leaf in its segment of the data
+func LeafReader(leaf *branch.Leaf, source data.Source) (*io.SectionReader, error) {
+	file, err := source.Segment(leaf.Segment)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(file, leaf.Position, leaf.Size), nil
+}
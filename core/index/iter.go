@@ -0,0 +1,20 @@
+package index
+
+import (
+	"iter"
+
+	"github.com/cyrildever/treee/core/index/branch"
+)
+
+//--- METHODS
+
+// All returns an iterator over a copy of every leaf of the index in the same stable order and with the same semantics as `Walk()`, eg.
+//
+//	for leaf := range treee.All() {
+//		...
+//	}
+func (t *Treee) All() iter.Seq[*branch.Leaf] {
+	return func(yield func(*branch.Leaf) bool) {
+		t.Walk(yield)
+	}
+}
@@ -0,0 +1,120 @@
+package index
+
+import (
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+//--- TYPES
+
+// Overlap is a region of a segment of the data claimed by two items
+type Overlap struct {
+	First   model.Hash `json:"first"`
+	Second  model.Hash `json:"second"`
+	Segment int        `json:"segment,omitempty"`
+	From    int64      `json:"from"`
+	To      int64      `json:"to"`
+}
+
+// Gap is a region of a segment of the data not claimed by any item
+type Gap struct {
+	Segment int   `json:"segment,omitempty"`
+	From    int64 `json:"from"`
+	To      int64 `json:"to"`
+}
+
+// LayoutReport lists the overlaps and gaps between the [Position, Position+Size) regions of all items in each segment of the data
+type LayoutReport struct {
+	Overlaps []Overlap `json:"overlaps"`
+	Gaps     []Gap     `json:"gaps"`
+}
+
+//--- METHODS
+
+// IsCorrupted returns `true` if any overlap was found, which always means corruption for an append-only file
+func (r LayoutReport) IsCorrupted() bool {
+	return len(r.Overlaps) > 0
+}
+
+// CheckLayout validates the layout of the items in each segment of the data
+func (t *Treee) CheckLayout() (report LayoutReport) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	report.Overlaps = []Overlap{}
+	report.Gaps = []Gap{}
+	var owner *located
+	segment := 0
+	end := int64(0)
+	for i := range t.positions {
+		leaf := &t.positions[i]
+		if leaf.Segment != segment {
+			// Each segment file starts anew
+			segment = leaf.Segment
+			end = 0
+			owner = nil
+		}
+		if owner != nil && leaf.Position < end {
+			to := leaf.Position + leaf.Size
+			if to > end {
+				to = end
+			}
+			firstStr, _ := owner.ID.String()
+			secondStr, _ := leaf.ID.String()
+			report.Overlaps = append(report.Overlaps, Overlap{
+				First:   model.Hash(firstStr),
+				Second:  model.Hash(secondStr),
+				Segment: segment,
+				From:    leaf.Position,
+				To:      to,
+			})
+		} else if leaf.Position > end {
+			report.Gaps = append(report.Gaps, Gap{
+				Segment: segment,
+				From:    end,
+				To:      leaf.Position,
+			})
+		}
+		if leaf.Position+leaf.Size > end {
+			end = leaf.Position + leaf.Size
+			owner = leaf
+		}
+	}
+	return
+}
+
+// UseStrictLayout makes the index reject the insertion of items overlapping existing ones in their segment of the data
+func (t *Treee) UseStrictLayout(value bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.strictLayout = value
+}
+
+// checkOverlap returns an `OverlappingItemError` if the passed item overlaps any existing item in its segment of the data
+func (t *Treee) checkOverlap(item *branch.Leaf) error {
+	i := t.searchPosition(item.Segment, item.Position)
+	if i < len(t.positions) {
+		if existing := t.positions[i]; existing.Segment == item.Segment && existing.Position < item.Position+item.Size {
+			return overlapping(item, existing)
+		}
+	}
+	// Any item starting before may cover the position, eg. around a smaller one if the index already had overlaps, but none of those
+	// starting further back than the size of the largest item
+	for j := i - 1; j >= 0 && t.positions[j].Segment == item.Segment && t.positions[j].Position+t.largest > item.Position; j-- {
+		if existing := t.positions[j]; existing.Position+existing.Size > item.Position {
+			return overlapping(item, existing)
+		}
+	}
+	return nil
+}
+
+//--- FUNCTIONS
+
+func overlapping(item *branch.Leaf, existing located) error {
+	idStr, _ := item.ID.String()
+	existingStr, _ := existing.ID.String()
+	return exception.NewOverlappingItemError(idStr, existingStr)
+}
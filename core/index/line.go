@@ -0,0 +1,111 @@
+package index
+
+import (
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+//--- METHODS
+
+// LinePage fetches at most `limit` items of the subchain of the passed ID (all of them if `limit` is not positive), starting right after
+// the `after` cursor if any, from the origin to the last item or from the last item to the origin if `reverse` is set;
+// the returned `next` cursor is empty when there's nothing more to fetch
+func (t *Treee) LinePage(id, after model.Hash, limit int, reverse bool) (page []*branch.Leaf, next model.Hash, err error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	found, err := t.search(id)
+	if err != nil {
+		return
+	}
+	origin := found
+	if found.Origin != found.ID {
+		if origin, err = t.search(found.Origin); err != nil {
+			return
+		}
+	}
+
+	// 1- Find the first item of the page
+	var current *branch.Leaf
+	if after.IsEmpty() {
+		current = origin
+		if reverse && origin.Next.NonEmpty() {
+			if current, err = t.search(origin.Previous); err != nil { // By definition of the circular linked list
+				return
+			}
+		}
+	} else {
+		cursor, e := t.search(after)
+		if e != nil {
+			err = e
+			return
+		}
+		if cursor.Origin != origin.ID {
+			afterStr, _ := after.String()
+			err = exception.NewNotFoundError(afterStr)
+			return
+		}
+		if current, err = t.neighbour(cursor, reverse); current == nil || err != nil {
+			return
+		}
+	}
+
+	// 2- Walk the subchain
+	for i := uint64(0); i <= t.size; i++ {
+		page = append(page, current)
+		following, e := t.neighbour(current, reverse)
+		if e != nil {
+			err = e
+			return
+		}
+		if following == nil {
+			return
+		}
+		if limit > 0 && len(page) == limit {
+			next = current.ID
+			return
+		}
+		current = following
+	}
+	return
+}
+
+// Next returns the item right after the passed ID in its subchain, or `nil` if it's the last one
+func (t *Treee) Next(id model.Hash) (*branch.Leaf, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	found, err := t.search(id)
+	if err != nil {
+		return nil, err
+	}
+	return t.neighbour(found, false)
+}
+
+// Prev returns the item right before the passed ID in its subchain, or `nil` if it's the origin
+// (whose `Previous` field actually points to the last item of the subchain)
+func (t *Treee) Prev(id model.Hash) (*branch.Leaf, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	found, err := t.search(id)
+	if err != nil {
+		return nil, err
+	}
+	return t.neighbour(found, true)
+}
+
+// neighbour returns the item right after the passed leaf in its subchain (or right before if `reverse` is set), or `nil` if it's at the end
+func (t *Treee) neighbour(leaf *branch.Leaf, reverse bool) (*branch.Leaf, error) {
+	if reverse {
+		if leaf.Origin == leaf.ID || leaf.Previous.IsEmpty() {
+			return nil, nil
+		}
+		return t.search(leaf.Previous)
+	}
+	if leaf.Next.IsEmpty() || leaf.Next == leaf.ID || leaf.Next == leaf.Origin {
+		return nil, nil
+	}
+	return t.search(leaf.Next)
+}
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/utils/prime"
+)
+
+// DEFAULT_CACHE_SIZE is the default number of nodes and leaves a paged index keeps in memory
+const DEFAULT_CACHE_SIZE = 100000
+
+//--- METHODS
+
+// CompactPages flushes a paged index and rewrites its page file without the records that changes made obsolete,
+// which `Flush()` also does by itself once they take more than half of the file; it does nothing for an in-memory index
+func (t *Treee) CompactPages() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.pager == nil {
+		return nil
+	}
+	return t.pager.Compact(t.size)
+}
+
+// Flush writes all the changes made to a paged index since the last flush to its page file;
+// it does nothing for an in-memory index
+func (t *Treee) Flush() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.pager == nil {
+		return nil
+	}
+	return t.pager.Flush(t.size)
+}
+
+// IsPaged tells whether the index is backed by a page file
+func (t *Treee) IsPaged() bool {
+	return t.pager != nil
+}
+
+// SavePages writes the whole index to a new page file at the passed path, eg. to turn a saved index into a paged one,
+// removing any delta snapshot left next to it
+func (t *Treee) SavePages(path string) error {
+	t.RLock()
+	defer t.RUnlock()
+
+	if err := branch.CreatePages(path, t.trunk, t.InitPrime, t.size); err != nil {
+		return err
+	}
+	removeDeltas(path)
+	return nil
+}
+
+// ensureIndexed builds the secondary indexes of a paged index the first time they're needed;
+// it must be called with at least the read lock held
+func (t *Treee) ensureIndexed() {
+	if t.pager == nil {
+		return
+	}
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+
+	if t.pendingIndexes {
+		t.indexChains()
+		t.indexPositions()
+		t.pendingIndexes = false
+	}
+}
+
+// hold prevents a paged index from evicting the leaves a writer is about to modify, returning the function to call when done
+func (t *Treee) hold() func() {
+	if t.pager == nil {
+		return func() {}
+	}
+	t.pager.Hold()
+	return t.pager.Release
+}
+
+//--- FUNCTIONS
+
+// OpenPaged returns an index backed by the page file at the passed path, reading its nodes and leaves on demand and keeping at most
+// `cacheSize` of them in memory (`DEFAULT_CACHE_SIZE` if not positive); the file is created with the passed initial prime if it doesn't exist,
+// otherwise the initial prime it was created with is used.
+//
+// Changes are only written to the page file by `Flush()` (or `Save()` and `Close()`), and the leaves they affect stay in memory until then.
+// The secondary indexes (subchains and positions) are only built the first time they're needed, which reads the whole tree once and keeps
+// the ID and region of every item in memory from then on, but not the leaves themselves.
+func OpenPaged(path string, initPrime uint64, cacheSize int) (t *Treee, err error) {
+	if initPrime == 0 {
+		initPrime = INIT_PRIME
+	}
+	if !prime.IsPrime(initPrime) {
+		return nil, prime.NewNotAValidNumberError(initPrime)
+	}
+	if cacheSize <= 0 {
+		cacheSize = DEFAULT_CACHE_SIZE
+	}
+	pager, err := branch.OpenPages(path, initPrime, cacheSize)
+	if err != nil {
+		return
+	}
+	t = &Treee{
+		InitPrime:      pager.InitPrime,
+		trunk:          pager.Root(),
+		size:           pager.Size,
+		pager:          pager,
+		pendingIndexes: true,
+	}
+	return
+}
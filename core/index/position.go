@@ -0,0 +1,114 @@
+package index
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+//--- TYPES
+
+// located is the entry of an item in the list sorted by segment and position: it only holds the region of the item and its ID,
+// so that a paged index doesn't keep all its leaves in memory and always reads their current state from the tree
+type located struct {
+	ID       model.Hash
+	Segment  int
+	Position int64
+	Size     int64
+}
+
+//--- METHODS
+
+// AtPosition returns the item whose bytes in the passed segment of the data include the passed offset
+func (t *Treee) AtPosition(segment int, offset int64) (*branch.Leaf, error) {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	// Last item starting at or before the offset
+	i := t.searchPosition(segment, offset+1) - 1
+	if i >= 0 && t.positions[i].Segment == segment && offset < t.positions[i].Position+t.positions[i].Size {
+		return t.search(t.positions[i].ID)
+	}
+	return nil, exception.NewNotFoundError(strconv.Itoa(segment) + ":" + strconv.FormatInt(offset, 10))
+}
+
+// PositionRange returns the items starting in the [from, to) range of the passed segment of the data, sorted by position
+func (t *Treee) PositionRange(segment int, from, to int64) []*branch.Leaf {
+	t.RLock()
+	defer t.RUnlock()
+	t.ensureIndexed()
+
+	var items []*branch.Leaf
+	for i := t.searchPosition(segment, from); i < len(t.positions) && t.positions[i].Segment == segment && t.positions[i].Position < to; i++ {
+		if leaf, err := t.search(t.positions[i].ID); err == nil {
+			items = append(items, leaf)
+		}
+	}
+	return items
+}
+
+// searchPosition returns the index of the first item at or after the passed position in the list sorted by segment and position
+func (t *Treee) searchPosition(segment int, position int64) int {
+	return sort.Search(len(t.positions), func(i int) bool {
+		return !t.positions[i].isBefore(segment, position)
+	})
+}
+
+// positionAdd inserts the passed leaf in the list of items sorted by segment and position
+func (t *Treee) positionAdd(leaf *branch.Leaf) {
+	i := t.searchPosition(leaf.Segment, leaf.Position+1)
+	t.positions = append(t.positions, located{})
+	copy(t.positions[i+1:], t.positions[i:])
+	t.positions[i] = locate(leaf)
+	if leaf.Size > t.largest {
+		t.largest = leaf.Size
+	}
+}
+
+// positionRemove takes the passed leaf out of the list of items sorted by segment and position
+func (t *Treee) positionRemove(leaf *branch.Leaf) {
+	for i := t.searchPosition(leaf.Segment, leaf.Position); i < len(t.positions) && t.positions[i].Segment == leaf.Segment && t.positions[i].Position == leaf.Position; i++ {
+		if t.positions[i].ID == leaf.ID {
+			t.positions = append(t.positions[:i], t.positions[i+1:]...)
+			return
+		}
+	}
+}
+
+// indexPositions builds the list of items sorted by segment and position from the content of the tree
+func (t *Treee) indexPositions() {
+	t.positions = make([]located, 0, t.size)
+	t.trunk.Walk(func(leaf *branch.Leaf) bool {
+		t.positions = append(t.positions, locate(leaf))
+		if leaf.Size > t.largest {
+			t.largest = leaf.Size
+		}
+		return true
+	})
+	sort.SliceStable(t.positions, func(i, j int) bool {
+		return t.positions[i].isBefore(t.positions[j].Segment, t.positions[j].Position)
+	})
+}
+
+// isBefore tells whether the item starts before the passed position in the data
+func (l located) isBefore(segment int, position int64) bool {
+	if l.Segment != segment {
+		return l.Segment < segment
+	}
+	return l.Position < position
+}
+
+//--- FUNCTIONS
+
+func locate(leaf *branch.Leaf) located {
+	return located{
+		ID:       leaf.ID,
+		Segment:  leaf.Segment,
+		Position: leaf.Position,
+		Size:     leaf.Size,
+	}
+}
@@ -0,0 +1,206 @@
+package index
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/utils/prime"
+)
+
+//--- TYPES
+
+// Step is a stage crossed when going down the Treee index, ie. the stage prime and the remainder of the ID modulo this prime,
+// along with the hashes needed to compute the hash of the node from the slot at this remainder, from the bottom up, in hexadecimal
+type Step struct {
+	StagePrime uint64   `json:"stagePrime"`
+	Remainder  uint64   `json:"remainder"`
+	Siblings   []string `json:"siblings"`
+}
+
+// AbsenceProof is the path followed by an ID down to either an empty branch or a different leaf (the witness), authenticated
+// by the root hash of the index it was built from (see `RootHash()`)
+type AbsenceProof struct {
+	ID      model.Hash `json:"id"`
+	Root    string     `json:"root"`
+	Path    []Step     `json:"path"`
+	Witness model.Hash `json:"witness,omitempty"`
+}
+
+//--- METHODS
+
+// ProveAbsent builds the proof that the passed ID isn't in the Treee index
+func (t *Treee) ProveAbsent(ID model.Hash) (proof *AbsenceProof, err error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	idStr, err := ID.String()
+	if err != nil {
+		return
+	}
+	if ID.IsEmpty() {
+		return nil, exception.NewInvalidHashStringError(idStr)
+	}
+	id := new(big.Int)
+	id.SetString(idStr, 16)
+	proof = &AbsenceProof{
+		ID:   model.Hash(idStr),
+		Root: hex.EncodeToString(t.trunk.Hash()),
+	}
+	var nodes []*branch.Node
+	defer func() {
+		if proof != nil {
+			for i, node := range nodes {
+				for _, sibling := range node.Siblings(proof.Path[i].Remainder) {
+					proof.Path[i].Siblings = append(proof.Path[i].Siblings, hex.EncodeToString(sibling))
+				}
+			}
+		}
+	}()
+	currentNode := t.trunk
+	currentStage := new(big.Int)
+	for {
+		usedStage := new(big.Int)
+		usedStage.Set(currentStage)
+		currentStage.SetUint64(currentNode.StagePrime)
+		if usedStage.Cmp(currentStage) == 0 {
+			return nil, exception.NewLoopError("proving")
+		}
+		modulo := new(big.Int)
+		modulo = modulo.Mod(id, currentStage)
+		idx := modulo.Uint64()
+		proof.Path = append(proof.Path, Step{
+			StagePrime: currentNode.StagePrime,
+			Remainder:  idx,
+		})
+		nodes = append(nodes, currentNode)
+		targetBranch, exists := currentNode.ChildAt(idx)
+		if exists {
+			if err = targetBranch.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if !exists || targetBranch.IsEmpty() {
+			return
+		} else if targetBranch.IsLeaf() {
+			found := targetBranch.GetLeaf()
+			if found.IsEmpty() {
+				return
+			}
+			if found.ID == proof.ID {
+				return nil, exception.NewAlreadyExistsInIndexError(idStr)
+			}
+			witness, _ := found.ID.String()
+			proof.Witness = model.Hash(witness)
+			return
+		} else if targetBranch.IsNode() {
+			currentNode = targetBranch.GetNode()
+		}
+	}
+}
+
+// RootHash returns the hash of the trunk of the index in hexadecimal, which commits to the IDs of all its items (see `branch.Node.Hash()`)
+// and against which the proofs of non-membership are checked
+func (t *Treee) RootHash() string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return hex.EncodeToString(t.trunk.Hash())
+}
+
+// invalidate forgets the hash of every node on the path of the passed ID, to be called with the lock held when a leaf is removed
+func (t *Treee) invalidate(ID model.Hash) {
+	idStr, err := ID.String()
+	if err != nil {
+		return
+	}
+	id := new(big.Int)
+	id.SetString(idStr, 16)
+	currentNode := t.trunk
+	for {
+		currentNode.Invalidate()
+		stage := new(big.Int).SetUint64(currentNode.StagePrime)
+		targetBranch, exists := currentNode.ChildAt(new(big.Int).Mod(id, stage).Uint64())
+		if !exists || !targetBranch.IsNode() {
+			return
+		}
+		currentNode = targetBranch.GetNode()
+	}
+}
+
+//--- FUNCTIONS
+
+// VerifyAbsence checks that the passed proof is consistent with the ID and the initial prime of the index it was built from, and that
+// the path it describes down to either an empty slot or the witness leads to the passed root hash (see `RootHash()`), which the client
+// should get from a source it trusts rather than from the proof itself
+func VerifyAbsence(ID model.Hash, initPrime uint64, root string, proof AbsenceProof) error {
+	idStr, err := ID.String()
+	if err != nil {
+		return err
+	}
+	if ID.IsEmpty() {
+		return exception.NewInvalidHashStringError(idStr)
+	}
+	if proofID, e := proof.ID.String(); e != nil || proofID != idStr {
+		return exception.NewInvalidProofError("not the proven ID")
+	}
+	if len(proof.Path) == 0 {
+		return exception.NewInvalidProofError("empty path")
+	}
+	expectedRoot, err := hex.DecodeString(root)
+	if err != nil {
+		return exception.NewInvalidProofError("invalid root hash")
+	}
+	var witness *big.Int
+	hash := branch.EmptySlotHash()
+	if proof.Witness.NonEmpty() {
+		witnessStr, _ := proof.Witness.String()
+		if witnessStr == idStr {
+			return exception.NewInvalidProofError("witness is the proven ID")
+		}
+		witness = new(big.Int)
+		witness.SetString(witnessStr, 16)
+		hash = branch.LeafHash(proof.Witness)
+	}
+	id := new(big.Int)
+	id.SetString(idStr, 16)
+	expectedStage := initPrime
+	for i, step := range proof.Path {
+		if i > 0 {
+			next, err := prime.Next(expectedStage)
+			if err != nil {
+				return err
+			}
+			expectedStage = next
+		}
+		if step.StagePrime != expectedStage {
+			return exception.NewInvalidProofError("unexpected stage prime")
+		}
+		stage := new(big.Int).SetUint64(step.StagePrime)
+		if new(big.Int).Mod(id, stage).Uint64() != step.Remainder {
+			return exception.NewInvalidProofError("wrong remainder")
+		}
+		if witness != nil && new(big.Int).Mod(witness, stage).Uint64() != step.Remainder {
+			return exception.NewInvalidProofError("witness is off the path")
+		}
+	}
+	for i := len(proof.Path) - 1; i >= 0; i-- {
+		step := proof.Path[i]
+		siblings := make([][]byte, len(step.Siblings))
+		for j, sibling := range step.Siblings {
+			if siblings[j], err = hex.DecodeString(sibling); err != nil {
+				return exception.NewInvalidProofError("invalid sibling hash")
+			}
+		}
+		if hash, err = branch.NodeHash(step.StagePrime, step.Remainder, hash, siblings); err != nil {
+			return exception.NewInvalidProofError(err.Error())
+		}
+	}
+	if !bytes.Equal(hash, expectedRoot) {
+		return exception.NewInvalidProofError("root hash mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"encoding/base64"
+	"math/big"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/utils/prime"
+)
+
+//--- METHODS
+
+// Scan returns copies of at most `limit` leaves (all of them if `limit` is not positive) in the stable order of `Walk()`, starting
+// right after the passed opaque cursor (or from the beginning if empty), along with the cursor to pass to get the next ones (empty when done).
+//
+// Since the order only depends on the residues of the IDs modulo the successive stage primes, and not on the current shape of the tree,
+// a scan could be resumed at any time: leaves inserted in the meantime are returned if and only if they come after the cursor.
+func (t *Treee) Scan(cursor string, limit int) (leaves []*branch.Leaf, next string, err error) {
+	var after *big.Int
+	if cursor != "" {
+		bytes, e := base64.RawURLEncoding.DecodeString(cursor)
+		if e != nil || len(bytes) == 0 {
+			err = exception.NewInvalidCursorError(cursor)
+			return
+		}
+		after = new(big.Int).SetBytes(bytes)
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	max := limit + 1 // To know whether there's a next page
+	if limit <= 0 {
+		max = 0
+	}
+	scan(t.trunk, after, after != nil, max, &leaves)
+	if limit > 0 && len(leaves) > limit {
+		leaves = leaves[:limit]
+		last, _ := leaves[limit-1].ID.Bytes()
+		next = base64.RawURLEncoding.EncodeToString(last)
+	}
+	return
+}
+
+//--- FUNCTIONS
+
+// scan appends to `leaves` copies of the leaves under the passed node coming after the `after` ID until there are `max` of them
+// (if positive), `onPath` telling whether the node is on the residue path of `after`; it returns `false` once full
+func scan(node *branch.Node, after *big.Int, onPath bool, max int, leaves *[]*branch.Leaf) bool {
+	stage := new(big.Int).SetUint64(node.StagePrime)
+	start := uint64(0)
+	if onPath {
+		start = new(big.Int).Mod(after, stage).Uint64()
+	}
+	for i := start; i < node.StagePrime; i++ {
+		b, exists := node.ChildAt(i)
+		if !exists {
+			continue
+		}
+		childOnPath := onPath && i == start
+		if b.IsLeaf() {
+			leaf := b.GetLeaf()
+			if leaf.IsEmpty() {
+				continue
+			}
+			if childOnPath {
+				idStr, err := leaf.ID.String()
+				if err != nil {
+					continue
+				}
+				id, _ := new(big.Int).SetString(idStr, 16)
+				if !comesAfter(id, after, node.StagePrime) {
+					continue
+				}
+			}
+			copied := *leaf
+			*leaves = append(*leaves, &copied)
+			if max > 0 && len(*leaves) == max {
+				return false
+			}
+		} else if b.IsNode() {
+			if !scan(b.GetNode(), after, childOnPath, max, leaves) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// comesAfter tells whether `id` comes after `other` in the residue order, both sharing the same residues up to the passed stage prime
+func comesAfter(id, other *big.Int, stagePrime uint64) bool {
+	if id.Cmp(other) == 0 {
+		return false
+	}
+	stage := stagePrime
+	for {
+		next, err := prime.Next(stage)
+		if err != nil {
+			// Beyond the known primes, fall back to the numerical order
+			return id.Cmp(other) > 0
+		}
+		stage = next
+		modulus := new(big.Int).SetUint64(stage)
+		a := new(big.Int).Mod(id, modulus)
+		b := new(big.Int).Mod(other, modulus)
+		if c := a.Cmp(b); c != 0 {
+			return c > 0
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package index
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/utils"
+)
+
+// SIGNATURE_SUFFIX is appended to the path of a saved index to get the path of its detached signature
+const SIGNATURE_SUFFIX = ".sig"
+
+//--- TYPES
+
+// Signature is the detached ed25519 signature of a saved index, written as JSON next to it
+type Signature struct {
+	Digest    string `json:"digest"`    // The SHA-256 hash of the file, in hexadecimal
+	PublicKey string `json:"publicKey"` // The public key to verify the signature with, in hexadecimal
+	Signature string `json:"signature"` // The signature of the digest, in base64
+}
+
+//--- METHODS
+
+// UseReadOnly makes every change to the index fail with a `ReadOnlyError` and prevents it from being saved, eg. when its signature
+// couldn't be verified
+func (t *Treee) UseReadOnly(value bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.readOnly = value
+}
+
+// UseSigning makes `Save()` and `SaveAs()` write the detached signature of the file with the passed key next to it
+// (see `SIGNATURE_SUFFIX`); passing `nil` deactivates it
+func (t *Treee) UseSigning(key ed25519.PrivateKey) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.signingKey = key
+}
+
+// verify checks that the passed digest of a file is the one signed by one of the passed trusted keys
+func (signature *Signature) verify(digest []byte, trusted []ed25519.PublicKey) error {
+	if hex.EncodeToString(digest) != strings.ToLower(signature.Digest) {
+		return exception.NewInvalidSignatureError("the file doesn't match the signed digest")
+	}
+	publicKey, err := hex.DecodeString(signature.PublicKey)
+	if err != nil {
+		return exception.NewInvalidSignatureError("malformed public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return exception.NewInvalidSignatureError("malformed signature")
+	}
+	for _, key := range trusted {
+		if bytes.Equal(key, publicKey) {
+			if !ed25519.Verify(key, digest, sig) {
+				return exception.NewInvalidSignatureError("wrong signature")
+			}
+			return nil
+		}
+	}
+	return exception.NewInvalidSignatureError("signed with an untrusted key: " + signature.PublicKey)
+}
+
+//--- FUNCTIONS
+
+// GenerateSigningKey returns a new ed25519 key pair for `UseSigning()` and `VerifySignature()`
+func GenerateSigningKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// ParsePrivateKey returns the ed25519 private key in the passed content, ie. its 32-byte seed or the 64-byte key, in hexadecimal or base64
+func ParsePrivateKey(content []byte) (ed25519.PrivateKey, error) {
+	key, err := decodeKey(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, errors.New("invalid private key: a 32-byte seed or a 64-byte key is expected")
+	}
+}
+
+// ParsePublicKeys returns the ed25519 public keys in the passed content, one per line in hexadecimal or base64, ignoring empty lines
+// and those starting with `#`
+func ParsePublicKeys(content []byte) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := decodeKey(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key: " + line)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
+// SignFile writes the detached signature of the file at the passed path with the passed key, eg. to sign a saved index before shipping it
+func SignFile(path string, key ed25519.PrivateKey) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	return writeSignature(path, h.Sum(nil), key)
+}
+
+// VerifySignature checks that the file at the passed path, and its delta snapshots if any (see `UseDeltas()`), have a detached signature
+// by one of the passed trusted keys, returning an `InvalidSignatureError` otherwise.
+//
+// NB: to load an index, prefer `LoadVerified()`, which checks what it actually reads, since the file could be replaced in between.
+func VerifySignature(path string, trusted []ed25519.PublicKey) error {
+	if err := verifyFile(path, trusted); err != nil {
+		return err
+	}
+	for _, deltaPath := range DeltaPaths(path) {
+		if err := verifyFile(deltaPath, trusted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyFile(path string, trusted []ed25519.PublicKey) error {
+	signature, err := readSignature(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	return signature.verify(h.Sum(nil), trusted)
+}
+
+// readSignature returns the detached signature of the file at the passed path, or an `InvalidSignatureError` if it's missing or malformed
+func readSignature(path string) (*Signature, error) {
+	content, err := os.ReadFile(path + SIGNATURE_SUFFIX)
+	if os.IsNotExist(err) {
+		return nil, exception.NewInvalidSignatureError("missing signature file")
+	} else if err != nil {
+		return nil, err
+	}
+	signature := Signature{}
+	if err = json.Unmarshal(content, &signature); err != nil {
+		return nil, exception.NewInvalidSignatureError("malformed signature file")
+	}
+	return &signature, nil
+}
+
+func decodeKey(str string) ([]byte, error) {
+	if key, err := hex.DecodeString(str); err == nil {
+		return key, nil
+	}
+	return base64.StdEncoding.DecodeString(str)
+}
+
+// writeSignature atomically writes the detached signature of the passed digest next to the file at the passed path
+func writeSignature(path string, digest []byte, key ed25519.PrivateKey) error {
+	signature := Signature{
+		Digest:    hex.EncodeToString(digest),
+		PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest)),
+	}
+	content, _ := json.MarshalIndent(signature, "", "  ")
+	return utils.WriteFileAtomically(path+SIGNATURE_SUFFIX, content)
+}
@@ -0,0 +1,129 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// GZIP compresses the saved index with gzip
+	GZIP = "gzip"
+	// ZSTD compresses the saved index with Zstandard, usually both smaller and faster than gzip
+	ZSTD = "zstd"
+	// NO_COMPRESSION saves the index as plain JSON
+	NO_COMPRESSION = "none"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+//--- TYPES
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+// nopCloser is a writer whose closing does nothing
+type nopCloser struct {
+	io.Writer
+}
+
+//--- METHODS
+
+// UseCompression sets the compression of the file written by `Save()` and `SaveAs()`: `GZIP`, `ZSTD` or `NO_COMPRESSION`;
+// by default, a loaded index keeps the compression of its file
+func (t *Treee) UseCompression(algorithm string) error {
+	if algorithm == "" {
+		algorithm = NO_COMPRESSION
+	}
+	if _, err := compressor(io.Discard, algorithm); err != nil {
+		return err
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	t.compression = algorithm
+	return nil
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+//--- FUNCTIONS
+
+// encode passes to the write function the writer compressing with the passed algorithm then encrypting with the passed key, if any,
+// to the passed writer
+func encode(w io.Writer, key []byte, algorithm string, write func(w io.Writer) error) error {
+	var encrypter io.WriteCloser = nopCloser{w}
+	if key != nil {
+		var err error
+		if encrypter, err = encrypted(w, key); err != nil {
+			return err
+		}
+	}
+	compressed, err := compressor(encrypter, algorithm)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(compressed)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if e := compressed.Close(); err == nil {
+		err = e
+	}
+	if e := encrypter.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// compressor returns the writer compressing to the passed one with the passed algorithm, to be closed once done
+func compressor(w io.Writer, algorithm string) (io.WriteCloser, error) {
+	switch algorithm {
+	case GZIP:
+		return gzip.NewWriter(w), nil
+	case ZSTD:
+		return zstd.NewWriter(w)
+	case NO_COMPRESSION, "":
+		return nopCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", algorithm)
+	}
+}
+
+// decompressor returns the reader decompressing the passed one according to the magic bytes at its start, along with the detected algorithm
+func decompressor(r io.Reader) (io.ReadCloser, string, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		return gz, GZIP, err
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, ZSTD, err
+		}
+		return zr.IOReadCloser(), ZSTD, nil
+	default:
+		return io.NopCloser(buffered), NO_COMPRESSION, nil
+	}
+}
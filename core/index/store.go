@@ -0,0 +1,302 @@
+package index
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cyrildever/treee/common/logger"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/store"
+)
+
+const (
+	// copyBatchSize is the number of leaves written at once when copying an index to a store
+	copyBatchSize = 1000
+
+	// storeRetryDelay is the time waited before writing to the store again after it failed, twice as long after each following failure
+	// up to `maxStoreRetryDelay`
+	storeRetryDelay    = 50 * time.Millisecond
+	maxStoreRetryDelay = 5 * time.Second
+)
+
+//--- TYPES
+
+// storeWriter writes the changes of the index to its store in the background, retrying while the store fails, so that the index is never
+// locked while waiting for it
+type storeWriter struct {
+	sync.Mutex
+	store    store.Store
+	pending  map[model.Hash]*branch.Leaf // The last state of each changed leaf not written yet, `nil` if removed
+	writing  bool
+	attempts int
+	err      error // The error of the last attempt, if it failed
+	changed  *sync.Cond
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+//--- METHODS
+
+// CopyTo writes all the leaves of the index to the passed store, eg. before mirroring an existing index to it with `UseStore()`
+func (t *Treee) CopyTo(s store.Store) error {
+	batch := make([]*branch.Leaf, 0, copyBatchSize)
+	var err error
+	t.Walk(func(leaf *branch.Leaf) bool {
+		batch = append(batch, leaf)
+		if len(batch) == copyBatchSize {
+			err = s.Put(batch...)
+			batch = batch[:0]
+		}
+		return err == nil
+	})
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+	return s.Put(batch...)
+}
+
+// UseStore mirrors every subsequent change of the index to the passed store; passing `nil` deactivates it.
+//
+// NB: the changes are written in the background, in the order they were made, each change being applied to the index whether the store
+// works or not; while it fails, the writes are tried again later, only the last state of each leaf being kept until then, so that the store
+// catches up with the index as soon as it works again. Use `SyncStore()` to wait for the changes made so far to be written.
+func (t *Treee) UseStore(s store.Store) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.writer != nil {
+		// What the previous store couldn't get is lost for it anyway
+		_ = t.writer.close()
+		t.writer = nil
+	}
+	t.store = s
+	t.touched = nil
+	t.deleted = nil
+	if s != nil {
+		t.writer = newStoreWriter(s)
+	}
+}
+
+// SyncStore waits for the changes made so far to be written to the store the index is mirrored to, if any, returning the error of the store
+// instead if its next attempt fails
+func (t *Treee) SyncStore() error {
+	t.RLock()
+	w := t.writer
+	t.RUnlock()
+	if w == nil {
+		return nil
+	}
+	return w.sync()
+}
+
+// deleteFromStore marks the passed ID as removed for the store, if any, and for the next delta snapshot
+func (t *Treee) deleteFromStore(id model.Hash) {
+	t.markDirty(id)
+	if t.store != nil {
+		t.deleted = append(t.deleted, id)
+	}
+}
+
+// touch marks the passed leaves as modified for the store, if any, and for the next delta snapshot
+func (t *Treee) touch(leaves ...*branch.Leaf) {
+	t.changes++
+	if t.dirty != nil {
+		for _, leaf := range leaves {
+			t.markDirty(leaf.ID)
+		}
+	}
+	if t.store != nil {
+		t.touched = append(t.touched, leaves...)
+	}
+	if t.pager != nil {
+		t.pager.Touch(leaves...)
+	}
+}
+
+// mirror hands the leaves modified and removed since its last call to the writer of the store, if any, without waiting for them to be written
+func (t *Treee) mirror() {
+	if t.writer != nil {
+		t.writer.add(t.touched, t.deleted)
+	}
+	t.touched = nil
+	t.deleted = nil
+}
+
+// add records the passed changes to write, copying the current state of the leaves since the index keeps modifying them
+func (w *storeWriter) add(touched []*branch.Leaf, deleted []model.Hash) {
+	w.Lock()
+	defer w.Unlock()
+
+	for _, id := range deleted {
+		w.pending[id] = nil
+	}
+	for _, leaf := range touched {
+		// A removed leaf is only an empty shadow by now, while an item removed then added again must stay
+		if !leaf.IsEmpty() {
+			copied := *leaf
+			w.pending[leaf.ID] = &copied
+		}
+	}
+	if len(w.pending) > 0 {
+		w.changed.Broadcast()
+	}
+}
+
+// run writes the pending changes until `close()` is called, waiting longer after each failure of the store
+func (w *storeWriter) run() {
+	log := logger.Init("index", "mirror")
+	defer close(w.done)
+
+	delay := storeRetryDelay
+	for {
+		w.Lock()
+		for len(w.pending) == 0 && !w.stopped() {
+			w.changed.Wait()
+		}
+		if len(w.pending) == 0 {
+			w.Unlock()
+			return
+		}
+		batch := w.pending
+		w.pending = make(map[model.Hash]*branch.Leaf)
+		w.writing = true
+		w.Unlock()
+
+		err := w.write(batch)
+
+		w.Lock()
+		w.writing = false
+		w.attempts++
+		if err != nil {
+			for id, leaf := range batch {
+				// Unless changed again in the meantime
+				if _, ok := w.pending[id]; !ok {
+					w.pending[id] = leaf
+				}
+			}
+			if w.err == nil {
+				log.Error("Unable to write to store, trying again", "error", err)
+			}
+		} else if w.err != nil {
+			log.Info("Store caught up with the index")
+		}
+		w.err = err
+		w.changed.Broadcast()
+		w.Unlock()
+
+		if err == nil {
+			delay = storeRetryDelay
+			continue
+		}
+		select {
+		case <-w.stop:
+			// Closing: the last attempt failed
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxStoreRetryDelay {
+			delay = maxStoreRetryDelay
+		}
+	}
+}
+
+// write puts the leaves of the passed batch in the store and deletes the removed ones
+func (w *storeWriter) write(batch map[model.Hash]*branch.Leaf) error {
+	leaves := make([]*branch.Leaf, 0, len(batch))
+	var deleted []model.Hash
+	for id, leaf := range batch {
+		if leaf == nil {
+			deleted = append(deleted, id)
+		} else {
+			leaves = append(leaves, leaf)
+		}
+	}
+	if len(leaves) > 0 {
+		if err := w.store.Put(leaves...); err != nil {
+			return err
+		}
+	}
+	if len(deleted) > 0 {
+		return w.store.Delete(deleted...)
+	}
+	return nil
+}
+
+// sync waits until nothing is pending, or until the next attempt fails to return its error
+func (w *storeWriter) sync() error {
+	w.Lock()
+	defer w.Unlock()
+
+	from := w.attempts
+	for len(w.pending) > 0 || w.writing {
+		if (w.attempts > from && w.err != nil) || w.stopped() {
+			return w.err
+		}
+		w.changed.Wait()
+	}
+	return nil
+}
+
+// close waits for the pending changes to be written, or for the current attempt to fail, and stops the writer
+func (w *storeWriter) close() error {
+	w.Lock()
+	close(w.stop)
+	w.changed.Broadcast()
+	w.Unlock()
+	<-w.done
+
+	w.Lock()
+	defer w.Unlock()
+	return w.err
+}
+
+func (w *storeWriter) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+//--- FUNCTIONS
+
+// FromStore builds an index with the passed initial prime from all the leaves of the passed store, as they were written, without mirroring
+// further changes to it (see `UseStore()`)
+func FromStore(s store.Reader, initPrime uint64) (t *Treee, err error) {
+	t, err = New(initPrime)
+	if err != nil {
+		return
+	}
+	var inserted error
+	err = s.Iterate(func(leaf *branch.Leaf) bool {
+		if !leaf.IsEmpty() {
+			if inserted = t.insert(leaf); inserted != nil {
+				return false
+			}
+			t.size++
+		}
+		return true
+	})
+	if err == nil {
+		err = inserted
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.reindex()
+	return
+}
+
+func newStoreWriter(s store.Store) *storeWriter {
+	w := &storeWriter{
+		store:   s,
+		pending: make(map[model.Hash]*branch.Leaf),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.changed = sync.NewCond(&w.Mutex)
+	go w.run()
+	return w
+}
@@ -1,27 +1,34 @@
 package index
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"math/big"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cyrildever/treee/common/logger"
 	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/data"
 	"github.com/cyrildever/treee/core/exception"
 	"github.com/cyrildever/treee/core/index/branch"
 	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/store"
 	"github.com/cyrildever/treee/utils"
+	"github.com/cyrildever/treee/utils/bloom"
 	"github.com/cyrildever/treee/utils/prime"
 )
 
 // Current is the current Treee index used when running the executable app
 var Current *Treee
 
-var saving bool = false
-
 const (
 	// INIT_PRIME ...
 	INIT_PRIME uint64 = 2 // TODO Shouldn't be used in production
@@ -37,6 +44,37 @@ type Treee struct {
 	size                uint64
 	persistence         bool
 	overridePersistence bool
+	chaining            bool
+	chains              map[model.Hash]*chain
+	slots               map[model.Hash]int
+	changes             uint64 // Incremented on every change of the leaves, see `sortedChains`
+	sorted              sortedChains
+	positions           []located
+	largest             int64 // The size of the largest item ever in the list sorted by segment and position, see `checkOverlap`
+	strictLayout        bool
+	contentSource       data.Source
+	hasher              data.Hasher
+	filter              *bloom.Filter
+	falsePositiveRate   float64
+	pager               *branch.Pager
+	indexMu             sync.Mutex
+	pendingIndexes      bool
+	store               store.Store
+	writer              *storeWriter
+	touched             []*branch.Leaf
+	deleted             []model.Hash
+	compression         string
+	key                 []byte
+	signingKey          ed25519.PrivateKey
+	readOnly            bool
+	generations         *generations
+	deltas              *deltas
+	dirty               map[model.Hash]struct{}
+	baseDigest          string
+	deltaCount          int
+	followed            string       // The segment and offset of the data indexed by its follower, as written in its offset file
+	saveMu              sync.Mutex   // Serializes the writes of the index file along with its signature
+	saveRequests        atomic.Int64 // The calls to `Save()` not yet covered by a save, merged into the next one while a save is running
 }
 
 //--- METHODS
@@ -45,12 +83,21 @@ type Treee struct {
 func (t *Treee) Add(item branch.Leaf) error {
 	t.Lock()
 	defer t.Unlock()
+	defer t.hold()()
 
-	log := logger.Init("index", "Add")
+	if t.readOnly {
+		return exception.NewReadOnlyError()
+	}
 
 	if item.Size == 0 {
 		return exception.NewEmptyItemError()
 	}
+	if item.Size < 0 {
+		return exception.NewInvalidSizeError(item.Size)
+	}
+	if item.Position < 0 {
+		return exception.NewInvalidPositionError(item.Position)
+	}
 	idStr, err := item.ID.String()
 	if err != nil {
 		return err
@@ -89,7 +136,78 @@ func (t *Treee) Add(item branch.Leaf) error {
 
 	item.Next = model.EmptyHash
 
+	if t.contentSource != nil {
+		if err := checkContent(&item, t.contentSource, t.hasher); err != nil {
+			return err
+		}
+	}
+
+	if t.strictLayout {
+		t.ensureIndexed()
+		if err := t.checkOverlap(&item); err != nil {
+			return err
+		}
+	}
+
+	if t.chaining {
+		predecessor := model.EmptyHash
+		if previous != &item {
+			if err := t.checkDigest(previous); err != nil {
+				return err
+			}
+			predecessor = previous.Digest
+		}
+		digest := item.ChainDigest(predecessor)
+		if passed, e := item.Digest.String(); e == nil && passed != "" && model.Hash(passed) != digest {
+			return exception.NewBrokenChainError(idStr)
+		}
+		item.Digest = digest
+	} else {
+		item.Digest = model.EmptyHash
+	}
+
 	// 2- Actually add it to the Treee index
+	if err := t.insert(&item); err != nil {
+		return err
+	}
+	previous.Next = item.ID
+	origin.Previous = item.ID
+	t.size++
+	t.indexLeaf(&item)
+	t.touch(&item, previous, origin)
+	t.mirror()
+	return nil
+}
+
+// Close flushes a paged index and closes its page file, and closes the store the index is mirrored to, if any, once the pending changes
+// are written to it or the store fails
+func (t *Treee) Close() error {
+	if t.pager != nil {
+		if err := t.Flush(); err != nil {
+			return err
+		}
+		if err := t.pager.Close(); err != nil {
+			return err
+		}
+	}
+	if t.store != nil {
+		if err := t.writer.close(); err != nil {
+			_ = t.store.Close()
+			return err
+		}
+		return t.store.Close()
+	}
+	return nil
+}
+
+// insert puts the passed leaf at its place in the tree, under a new node if the place is already taken by another leaf
+func (t *Treee) insert(item *branch.Leaf) error {
+	log := logger.Init("index", "insert")
+
+	idStr, err := item.ID.String()
+	if err != nil {
+		return err
+	}
 	id := new(big.Int)
 	id.SetString(idStr, 16)
 	currentNode := t.trunk
@@ -101,19 +219,23 @@ func (t *Treee) Add(item branch.Leaf) error {
 		if usedStage.Cmp(currentStage) == 0 {
 			return exception.NewLoopError("adding")
 		}
+		currentNode.Invalidate()
 		modulo := new(big.Int)
 		modulo = modulo.Mod(id, currentStage)
 		idx := modulo.Uint64()
 		targetBranch, exists := currentNode.ChildAt(idx)
+		if exists {
+			// An unreadable branch of a paged index mustn't be taken for an empty one and overwritten
+			if err = targetBranch.Err(); err != nil {
+				return err
+			}
+		}
 		if !exists || targetBranch.IsEmpty() {
-			if !targetBranch.Assign(&item) {
+			if !targetBranch.Assign(item) {
 				// This shouldn't happen so we'd better log it
-				log.Crit("Impossible to assign non-pointer", "leafPtr", &item)
+				log.Crit("Impossible to assign non-pointer", "leafPtr", item)
 				return utils.NewNotAPointerError()
 			}
-			previous.Next = item.ID
-			origin.Previous = item.ID
-			t.size++
 			return nil
 		} else if targetBranch.IsLeaf() {
 			existingLeaf := targetBranch.GetLeaf()
@@ -125,15 +247,12 @@ func (t *Treee) Add(item branch.Leaf) error {
 			}
 			newNode := branch.NewNode(nextPrime)
 			newNode.AddLeaf(existingLeaf)
-			newNode.AddLeaf(&item)
+			newNode.AddLeaf(item)
 			if !targetBranch.Assign(newNode) {
 				// This shouldn't happen so we'd better log it
 				log.Crit("Impossible to assign non-pointer", "nodePtr", newNode)
 				return utils.NewNotAPointerError()
 			}
-			previous.Next = item.ID
-			origin.Previous = item.ID
-			t.size++
 			return nil
 		} else if targetBranch.IsNode() {
 			currentNode = targetBranch.GetNode()
@@ -167,11 +286,30 @@ func (t *Treee) Last(id model.Hash) (lastInChain *branch.Leaf, err error) {
 	return
 }
 
+// CheckIntegrity verifies the running digest of every subchain in the index, returning a `BrokenChainError` on the first rewrite found
+func (t *Treee) CheckIntegrity() (err error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	t.trunk.Walk(func(leaf *branch.Leaf) bool {
+		if leaf.Origin != leaf.ID {
+			return true
+		}
+		err = t.verifyLine(leaf.ID)
+		return err == nil
+	})
+	return
+}
+
 // Line fetches the whole list of items in a subchain
 func (t *Treee) Line(id model.Hash) (subchain []*branch.Leaf, err error) {
 	t.RLock()
 	defer t.RUnlock()
 
+	return t.line(id)
+}
+
+func (t *Treee) line(id model.Hash) (subchain []*branch.Leaf, err error) {
 	found, err := t.search(id)
 	if err != nil {
 		return
@@ -207,7 +345,9 @@ func (t *Treee) PrintAll(beautify bool) string {
 	t.RLock()
 	defer t.RUnlock()
 
-	str := `{"initPrime":` + strconv.FormatUint(t.InitPrime, 10) + `,"trunk":` + t.trunk.Print() + `,"size":` + strconv.FormatUint(t.size, 10) + "}"
+	var sb strings.Builder
+	_, _ = t.writeTo(&sb)
+	str := sb.String()
 	if beautify {
 		var js interface{}
 		_ = json.Unmarshal([]byte(str), &js)
@@ -221,6 +361,11 @@ func (t *Treee) PrintAll(beautify bool) string {
 func (t *Treee) Remove(id model.Hash) error {
 	t.Lock()
 	defer t.Unlock()
+	defer t.hold()()
+
+	if t.readOnly {
+		return exception.NewReadOnlyError()
+	}
 
 	found, err := t.search(id)
 	if err != nil {
@@ -233,16 +378,34 @@ func (t *Treee) Remove(id model.Hash) error {
 				previous.Next = found.Next
 				if next, e := t.search(found.Next); e == nil {
 					next.Previous = previous.ID
+					t.touch(next)
 				}
 			} else {
 				previous.Next = model.EmptyHash
 				if origin, e := t.search(found.Origin); e == nil {
 					origin.Previous = previous.ID
+					t.touch(origin)
 				}
 			}
+			t.touch(previous)
 		}
 	}
 
+	if t.chaining && found.Origin != found.ID && found.Next.NonEmpty() {
+		if next, e := t.search(found.Next); e == nil {
+			if previous, e := t.search(found.Previous); e == nil {
+				// The rest of the subchain must be sealed again, which is what a rewrite would do as well: leave a trace of it
+				resealed := t.seal(next, previous.Digest)
+				log := logger.Init("index", "Remove")
+				log.Warn("Subchain resealed after a removal", "id", found.ID, "origin", found.Origin, "resealed", resealed)
+			}
+		}
+	}
+
+	t.unindexLeaf(found)
+	t.deleteFromStore(found.ID)
+	t.invalidate(found.ID)
+
 	// 2- Make it an empty "shadow" leaf
 	// TODO Actually remove it from the Treee index
 	empty := branch.NewEmptyLeaf()
@@ -252,44 +415,138 @@ func (t *Treee) Remove(id model.Hash) error {
 	found.Origin = empty.Origin
 	found.Previous = empty.Previous
 	found.Next = empty.Next
+	found.Digest = empty.Digest
 
 	t.size--
 
+	t.mirror()
 	return nil
 }
 
-// Save ...
+// Save writes the index to its file if persistence is activated, or flushes a paged index to its page file whatever the persistence settings;
+// an index mirrored to a store (see `UseStore()`) is never written to a file
 func (t *Treee) Save() {
 	log := logger.Init("index", "Save")
 	conf, _ := config.GetConfig()
 
-	if !saving && (t.persistence || (!t.overridePersistence && conf.UsePersistence)) && !conf.IsTestEnvironment() {
-		saving = true
-		t0 := time.Now().UnixNano()
+	if t.store != nil {
+		// Already mirrored to its store
+		return
+	}
+
+	if t.pager != nil {
+		if err := t.Flush(); err != nil {
+			log.Error("An error occurred while flushing the index", "error", err)
+		}
+		return
+	}
+
+	if (t.persistence || (!t.overridePersistence && conf.UsePersistence)) && !conf.IsTestEnvironment() {
+		if t.saveRequests.Add(1) > 1 {
+			// The running save will save again once done
+			return
+		}
 		path := conf.IndexPath
 		if path == "" {
 			path = "saved" + string(os.PathSeparator) + "treee.json"
 		}
-		f, err := os.Create(path)
-		if err != nil {
-			log.Crit("Unable to create file", "error", err)
-			saving = false
-			return
-		}
-		size := t.Size()
-		n, err := f.WriteString(t.PrintAll(false))
-		if err != nil {
+		for {
+			requests := t.saveRequests.Load()
+			t0 := time.Now().UnixNano()
+			size := t.Size()
+			n, err := t.saveTo(path)
 			t1 := time.Now().UnixNano()
-			log.Error("An error occurred while saving the index", "error", err, "after", strconv.FormatInt((t1-t0)/int64(time.Millisecond), 10)+"ms")
-			saving = false
-			return
+			if err != nil {
+				log.Error("An error occurred while saving the index", "error", err, "after", strconv.FormatInt((t1-t0)/int64(time.Millisecond), 10)+"ms")
+			} else {
+				log.Info("Index saved", "size", size, "bytes", n, "duration", strconv.FormatInt((t1-t0)/int64(time.Millisecond), 10)+"ms")
+			}
+			if t.saveRequests.Add(-requests) == 0 {
+				return
+			}
 		}
-		t1 := time.Now().UnixNano()
-		log.Info("Index saved", "size", size, "bytes", n, "duration", strconv.FormatInt((t1-t0)/int64(time.Millisecond), 10)+"ms")
-		f.Close()
-		saving = false
+	}
+}
+
+// SaveAs writes the index to the passed file path whatever the persistence settings, compressed as set by `UseCompression()`, returning
+// the number of bytes written; the file is replaced atomically so that a crash never leaves a truncated index behind, and its delta snapshots
+// are removed, the next one written by `SaveDelta()` being a full snapshot
+func (t *Treee) SaveAs(path string) (int, error) {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	n, _, err := t.saveAs(path)
+	if err != nil {
+		return 0, err
+	}
+	removeDeltas(path)
+	if d := t.deltas; d != nil {
+		// The deltas of the index file could have been the ones removed
+		d.Lock()
+		d.base, d.count = "", 0
+		d.Unlock()
+	}
+	return n, nil
+}
+
+// saveAs writes the index to the passed file path like `SaveAs()`, also returning the SHA-256 hash of the file
+func (t *Treee) saveAs(path string) (int, []byte, error) {
+	t.RLock()
+	readOnly, signingKey := t.readOnly, t.signingKey
+	t.RUnlock()
+	if readOnly {
+		return 0, nil, exception.NewReadOnlyError()
+	}
+
+	counter := &countingWriter{}
+	h := sha256.New()
+	err := utils.WriteAtomically(path, func(w io.Writer) error {
+		counter.w = io.MultiWriter(w, h)
+		_, err := t.WriteTo(counter)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	digest := h.Sum(nil)
+	if signingKey != nil {
+		// A crash before the signature is written leaves a file that fails verification rather than a wrongly trusted one
+		if err = writeSignature(path, digest, signingKey); err != nil {
+			return 0, nil, err
+		}
+	}
+	return counter.n, digest, nil
+}
+
+// WriteTo writes the JSON representation of the whole index to the passed writer as it goes, compressed as set by `UseCompression()`
+// then encrypted as set by `UseEncryption()`, returning the number of plain bytes; it implements `io.WriterTo`
+func (t *Treee) WriteTo(w io.Writer) (n int64, err error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	err = encode(w, t.key, t.compression, func(w io.Writer) (e error) {
+		n, e = t.writeTo(w)
 		return
+	})
+	return
+}
+
+// writeTo writes the uncompressed JSON representation of the index
+func (t *Treee) writeTo(w io.Writer) (int64, error) {
+	written := int64(0)
+	c, err := io.WriteString(w, `{"initPrime":`+strconv.FormatUint(t.InitPrime, 10)+`,"trunk":`)
+	written += int64(c)
+	if err != nil {
+		return written, err
+	}
+	n, err := t.trunk.WriteTo(w)
+	written += n
+	if err != nil {
+		return written, err
 	}
+	c, err = io.WriteString(w, `,"size":`+strconv.FormatUint(t.size, 10)+"}")
+	written += int64(c)
+	return written, err
 }
 
 // Search fetches a Leaf from the Treee index;
@@ -309,6 +566,10 @@ func (t *Treee) search(ID model.Hash) (found *branch.Leaf, err error) {
 	if ID.IsEmpty() {
 		return nil, exception.NewInvalidHashStringError(idStr)
 	}
+	if !t.mayContain(idStr) {
+		err = exception.NewNotFoundError(idStr)
+		return
+	}
 	id := new(big.Int)
 	id.SetString(idStr, 16)
 	currentNode := t.trunk
@@ -325,6 +586,11 @@ func (t *Treee) search(ID model.Hash) (found *branch.Leaf, err error) {
 		modulo = modulo.Mod(id, currentStage)
 		idx := modulo.Uint64()
 		targetBranch, exists := currentNode.ChildAt(idx)
+		if exists {
+			if err = targetBranch.Err(); err != nil {
+				return
+			}
+		}
 		if !exists || targetBranch.IsEmpty() {
 			err = exception.NewNotFoundError(idStr)
 			return
@@ -334,6 +600,12 @@ func (t *Treee) search(ID model.Hash) (found *branch.Leaf, err error) {
 			if found.IsEmpty() {
 				found = nil
 				err = exception.NewNotFoundError(idStr)
+				return
+			}
+			// The leaf at the end of the path may be a different item sharing the same residues so far
+			if foundStr, _ := found.ID.String(); foundStr != idStr {
+				found = nil
+				err = exception.NewNotFoundError(idStr)
 			}
 			return
 		} else if targetBranch.IsNode() {
@@ -350,6 +622,51 @@ func (t *Treee) Size() uint64 {
 	return t.size
 }
 
+// UseHashChaining activates or deactivates the running digest of subchain items, sealing the subchains without any digest when activated.
+//
+// A subchain whose digests stop partway, eg. because items were appended while it was deactivated or because digests were removed to hide
+// a rewrite, isn't sealed again: a `BrokenChainError` is returned instead and hash chaining isn't activated.
+func (t *Treee) UseHashChaining(value bool) error {
+	t.Lock()
+	defer t.Unlock()
+	defer t.hold()()
+
+	if !value {
+		t.chaining = false
+		return nil
+	}
+	var err error
+	var unsealed []*branch.Leaf
+	t.trunk.Walk(func(leaf *branch.Leaf) bool {
+		if leaf.Origin != leaf.ID {
+			return true
+		}
+		subchain, _ := t.line(leaf.ID)
+		sealed := 0
+		for _, item := range subchain {
+			if item.Digest.NonEmpty() {
+				sealed++
+			}
+		}
+		if sealed == 0 {
+			unsealed = append(unsealed, leaf)
+		} else if sealed < len(subchain) {
+			idStr, _ := leaf.ID.String()
+			err = exception.NewBrokenChainError(idStr)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, origin := range unsealed {
+		t.seal(origin, model.EmptyHash)
+	}
+	t.chaining = true
+	t.mirror()
+	return nil
+}
+
 // UsePersistence forces the index to be permanent or not, overriding the corresponding configuration parameter
 func (t *Treee) UsePersistence(value bool) {
 	conf, _ := config.GetConfig()
@@ -358,17 +675,151 @@ func (t *Treee) UsePersistence(value bool) {
 	t.overridePersistence = true
 }
 
+// VerifyLine checks the running digest of the whole subchain of the passed ID, returning a `BrokenChainError` if its history was rewritten
+func (t *Treee) VerifyLine(id model.Hash) error {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.verifyLine(id)
+}
+
+func (t *Treee) verifyLine(id model.Hash) error {
+	subchain, err := t.line(id)
+	if err != nil {
+		return err
+	}
+	predecessor := model.EmptyHash
+	for _, leaf := range subchain {
+		if leaf.Digest != leaf.ChainDigest(predecessor) {
+			idStr, _ := leaf.ID.String()
+			return exception.NewBrokenChainError(idStr)
+		}
+		predecessor = leaf.Digest
+	}
+	return nil
+}
+
+// indexLeaf adds the passed leaf to the secondary indexes
+func (t *Treee) indexLeaf(leaf *branch.Leaf) {
+	t.changes++
+	if !t.pendingIndexes {
+		t.chainAdd(leaf)
+		t.positionAdd(leaf)
+	}
+	if t.filter != nil {
+		t.filterAdd(leaf)
+	}
+}
+
+// unindexLeaf removes the passed leaf from the secondary indexes
+func (t *Treee) unindexLeaf(leaf *branch.Leaf) {
+	t.changes++
+	if !t.pendingIndexes {
+		t.chainRemove(leaf)
+		t.positionRemove(leaf)
+	}
+}
+
+// reindex builds all the secondary indexes from the content of the tree
+func (t *Treee) reindex() {
+	t.indexChains()
+	t.indexPositions()
+	if t.filter != nil {
+		t.indexFilter()
+	}
+}
+
+// checkDigest verifies the digest of the passed leaf against the one of its predecessor
+func (t *Treee) checkDigest(leaf *branch.Leaf) error {
+	predecessor := model.EmptyHash
+	if leaf.Origin != leaf.ID {
+		previous, err := t.search(leaf.Previous)
+		if err != nil {
+			return err
+		}
+		predecessor = previous.Digest
+	}
+	if leaf.Digest != leaf.ChainDigest(predecessor) {
+		idStr, _ := leaf.ID.String()
+		return exception.NewBrokenChainError(idStr)
+	}
+	return nil
+}
+
+// seal (re)computes the digests of the subchain from the passed leaf to its end, returning the number of leaves sealed
+func (t *Treee) seal(from *branch.Leaf, predecessor model.Hash) (sealed int) {
+	current := from
+	for i := uint64(0); i <= t.size; i++ {
+		current.Digest = current.ChainDigest(predecessor)
+		t.touch(current)
+		sealed++
+		predecessor = current.Digest
+		if current.Next.IsEmpty() || current.Next == current.Origin {
+			return
+		}
+		next, err := t.search(current.Next)
+		if err != nil {
+			return
+		}
+		current = next
+	}
+	return
+}
+
 //--- FUNCTIONS
 
-// Load ...
+// Load reads the index saved at the passed path, detecting whether it's compressed (see `UseCompression()`);
+// it returns a `WrongKeyError` if it's encrypted (see `LoadEncrypted()`)
 func Load(path string) (t *Treee, err error) {
+	return LoadEncrypted(path, nil)
+}
+
+// LoadEncrypted reads the index saved at the passed path like `Load()`, decrypting it with the passed key if it's encrypted
+// (see `UseEncryption()`), returning a `WrongKeyError` if it was encrypted with another key
+func LoadEncrypted(path string, key []byte) (t *Treee, err error) {
+	return load(path, key, nil)
+}
+
+// LoadVerified reads the index saved at the passed path like `LoadEncrypted()`, checking in the same pass that the file and its delta snapshots
+// are the ones signed by one of the passed trusted keys (see `UseSigning()`), so that what's loaded is what was verified; if they aren't,
+// it returns the loaded index along with an `InvalidSignatureError`, eg. to serve it read-only, any other error coming without the index
+func LoadVerified(path string, key []byte, trusted []ed25519.PublicKey) (*Treee, error) {
+	return load(path, key, trusted)
+}
+
+// load reads the index saved at the passed path, also verifying its signature if passed trusted keys (see `LoadVerified()`)
+func load(path string, key []byte, trusted []ed25519.PublicKey) (t *Treee, err error) {
 	if path == "" {
 		path = "saved" + string(os.PathSeparator) + "treee.json"
 	}
+	var signature *Signature
+	var unverified error
+	if trusted != nil {
+		if signature, unverified = readSignature(path); unverified != nil {
+			if _, ok := unverified.(*exception.InvalidSignatureError); !ok {
+				return nil, unverified
+			}
+		}
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return
 	}
+	defer f.Close()
+	h := sha256.New()
+	plain, isEncrypted, err := decrypted(io.TeeReader(f, h), key)
+	if err != nil {
+		return
+	}
+	deltaKey := key
+	if !isEncrypted {
+		key = nil
+	}
+	r, compression, err := decompressor(plain)
+	if err != nil {
+		return
+	}
+	defer r.Close()
 
 	type savedTreee struct {
 		InitPrime uint64                 `json:"initPrime"`
@@ -377,7 +828,7 @@ func Load(path string) (t *Treee, err error) {
 	}
 
 	st := savedTreee{}
-	decoder := json.NewDecoder(f)
+	decoder := json.NewDecoder(r)
 	err = decoder.Decode(&st)
 	if err != nil {
 		return
@@ -403,15 +854,33 @@ func Load(path string) (t *Treee, err error) {
 	var treee Treee
 	if actualSize == int(st.Size) {
 		treee = Treee{
-			InitPrime: st.InitPrime,
-			trunk:     trunk,
-			size:      st.Size,
+			InitPrime:   st.InitPrime,
+			trunk:       trunk,
+			size:        st.Size,
+			compression: compression,
+			key:         key,
 		}
+		treee.reindex()
 	} else {
 		return &treee, exception.NewIncoherentSizeError(int(st.Size), actualSize)
 	}
 
-	return &treee, nil
+	// The deltas only apply to the exact file they were written after, which is also the signed one
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	digest := h.Sum(nil)
+	if signature != nil {
+		unverified = signature.verify(digest, trusted)
+	}
+	err = treee.applyDeltas(path, hex.EncodeToString(digest), deltaKey, trusted)
+	if _, ok := err.(*exception.InvalidSignatureError); err != nil && !ok {
+		return nil, err
+	} else if unverified == nil {
+		unverified = err
+	}
+
+	return &treee, unverified
 }
 
 // New ...
@@ -468,15 +937,19 @@ func parse(node *branch.Node, arr []interface{}, actualSize *int) error {
 						}
 					} else {
 						if _, ok := value["id"]; ok {
+							segment, _ := value["segment"].(float64)
 							position, _ := value["position"].(float64)
 							size, _ := value["size"].(float64)
+							digest, _ := value["digest"].(string)
 							leaf := branch.Leaf{
 								ID:       model.Hash(value["id"].(string)),
+								Segment:  int(segment),
 								Position: int64(position),
 								Size:     int64(size),
 								Origin:   model.Hash(value["origin"].(string)),
 								Previous: model.Hash(value["previous"].(string)),
 								Next:     model.Hash(value["next"].(string)),
+								Digest:   model.Hash(digest),
 							}
 							if !b.Assign(&leaf) {
 								return utils.NewNotAPointerError()
@@ -484,7 +957,11 @@ func parse(node *branch.Node, arr []interface{}, actualSize *int) error {
 						}
 					}
 				}
-				if b.IsLeaf() {
+				if b.IsLeaf() && b.GetLeaf().IsEmpty() {
+					// The shadow leaf of a removed item
+					r, _ := strconv.Atoi(remainder)
+					node.AddBranch(&branch.Branch{}, uint64(r))
+				} else if b.IsLeaf() {
 					(*actualSize)++
 					node.AddLeaf(b.GetLeaf())
 				} else if b.IsNode() {
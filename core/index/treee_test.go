@@ -1,6 +1,11 @@
 package index_test
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -10,11 +15,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cyrildever/treee/core/data"
 	"github.com/cyrildever/treee/core/exception"
 	"github.com/cyrildever/treee/core/index"
 	"github.com/cyrildever/treee/core/index/branch"
 	"github.com/cyrildever/treee/core/index/search"
 	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/store"
 	"gotest.tools/assert"
 )
 
@@ -114,6 +121,14 @@ func TestTreee(t *testing.T) {
 	assert.Assert(t, ok)
 	assert.Equal(t, treee.Size(), uint64(2))
 
+	// Saved along with the shadow leaf of the removed item
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	_, err = treee.SaveAs(path)
+	assert.NilError(t, err)
+	loaded, err := index.Load(path)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(2))
+
 	// Re-add
 	reThirdLeaf := branch.Leaf{
 		ID:       model.Hash("abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890"),
@@ -187,6 +202,15 @@ func TestLoad(t *testing.T) {
 		t.Fatal(err)
 	}
 	assert.Equal(t, treee.Size(), uint64(3))
+
+	// Leaves in sub-nodes are reachable too
+	found, err := treee.Search(model.Hash("1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, found.Size, int64(100))
+	assert.Equal(t, treee.CheckLayout().IsCorrupted(), false)
+	assert.Equal(t, len(treee.CheckLayout().Gaps), 0)
 }
 
 // TestScalability ...
@@ -247,3 +271,1594 @@ func TestScalability(t *testing.T) {
 
 	// assert.Assert(t, false) // TODO Uncomment to get performance logs
 }
+
+// TestProveAbsent ...
+func TestProveAbsent(t *testing.T) {
+	treee, _ := index.New(index.INIT_PRIME)
+	present := branch.Leaf{
+		ID:       model.Hash("1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"),
+		Position: 0,
+		Size:     100,
+	}
+	_ = treee.Add(present)
+	_ = treee.Add(branch.Leaf{
+		ID:       model.Hash("fedcba0987654321fedcba0987654321fedcba0987654321fedcba0987654321"),
+		Position: 100,
+		Size:     50,
+	})
+
+	_, err := treee.ProveAbsent(present.ID)
+	_, ok := err.(*exception.AlreadyExistsInIndexError)
+	assert.Assert(t, ok)
+
+	absent := model.Hash("abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890")
+	_, err = treee.Search(absent)
+	_, ok = err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+	proof, err := treee.ProveAbsent(absent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(proof.Path) > 0)
+	assert.Equal(t, proof.Path[0].StagePrime, index.INIT_PRIME)
+	root := treee.RootHash()
+	assert.Equal(t, proof.Root, root)
+	err = index.VerifyAbsence(absent, treee.InitPrime, root, *proof)
+	assert.NilError(t, err)
+
+	// Tampered proofs
+	err = index.VerifyAbsence(absent, 3, root, *proof)
+	assert.Error(t, err, "invalid proof: unexpected stage prime")
+	tampered := *proof
+	tampered.Witness = present.ID
+	err = index.VerifyAbsence(present.ID, treee.InitPrime, root, tampered)
+	assert.Error(t, err, "invalid proof: not the proven ID")
+	tampered.ID = present.ID
+	err = index.VerifyAbsence(present.ID, treee.InitPrime, root, tampered)
+	assert.Error(t, err, "invalid proof: witness is the proven ID")
+
+	// A made-up path doesn't lead to the root
+	forged, _ := index.New(index.INIT_PRIME)
+	_ = forged.Add(branch.Leaf{ID: model.Hash("fedcba0987654321fedcba0987654321fedcba0987654321fedcba0987654321"), Position: 100, Size: 50})
+	forgedProof, err := forged.ProveAbsent(present.ID)
+	assert.NilError(t, err)
+	err = index.VerifyAbsence(present.ID, treee.InitPrime, root, *forgedProof)
+	assert.Error(t, err, "invalid proof: root hash mismatch")
+
+	// The root follows the changes of the index
+	for i := 1; i <= 500; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(200 + i*10), Size: 10})
+	}
+	assert.Assert(t, treee.RootHash() != root)
+	err = index.VerifyAbsence(absent, treee.InitPrime, treee.RootHash(), *proof)
+	assert.Error(t, err, "invalid proof: root hash mismatch")
+	_ = treee.Remove(model.Hash(fmt.Sprintf("%064x", 42)))
+	for _, id := range []model.Hash{absent, model.Hash(fmt.Sprintf("%064x", 42)), model.Hash(fmt.Sprintf("%064x", 501))} {
+		proof, err = treee.ProveAbsent(id)
+		assert.NilError(t, err)
+		err = index.VerifyAbsence(id, treee.InitPrime, treee.RootHash(), *proof)
+		assert.NilError(t, err)
+	}
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	_, _ = treee.SaveAs(path)
+	loaded, err := index.Load(path)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.RootHash(), treee.RootHash())
+}
+
+// TestHashChaining ...
+func TestHashChaining(t *testing.T) {
+	treee, _ := index.New(index.INIT_PRIME)
+	_ = treee.UseHashChaining(true)
+	firstLeaf := branch.Leaf{
+		ID:       model.Hash("1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"),
+		Position: 0,
+		Size:     100,
+	}
+	_ = treee.Add(firstLeaf)
+	secondLeaf := branch.Leaf{
+		ID:       model.Hash("fedcba0987654321fedcba0987654321fedcba0987654321fedcba0987654321"),
+		Position: 100,
+		Size:     50,
+		Previous: firstLeaf.ID,
+	}
+	_ = treee.Add(secondLeaf)
+	thirdLeaf := branch.Leaf{
+		ID:       model.Hash("abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890"),
+		Position: 150,
+		Size:     10,
+		Previous: secondLeaf.ID,
+	}
+	err := treee.Add(thirdLeaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NilError(t, treee.VerifyLine(thirdLeaf.ID))
+	assert.NilError(t, treee.CheckIntegrity())
+
+	found, _ := treee.Search(firstLeaf.ID)
+	assert.Equal(t, found.Digest, found.ChainDigest(model.EmptyHash))
+
+	// Removing an item reseals the rest of the subchain
+	err = treee.Remove(secondLeaf.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NilError(t, treee.VerifyLine(firstLeaf.ID))
+
+	// Tampering with the history is detected
+	found, _ = treee.Search(thirdLeaf.ID)
+	found.Size = 11
+	err = treee.VerifyLine(firstLeaf.ID)
+	_, ok := err.(*exception.BrokenChainError)
+	assert.Assert(t, ok)
+	err = treee.Add(branch.Leaf{
+		ID:       model.Hash("0987654321fedcba0987654321fedcba0987654321fedcba0987654321fedcba"),
+		Position: 160,
+		Size:     10,
+		Previous: thirdLeaf.ID,
+	})
+	_, ok = err.(*exception.BrokenChainError)
+	assert.Assert(t, ok)
+
+	// Only subchains without any digest are sealed upon activation
+	unsealed, _ := index.New(index.INIT_PRIME)
+	_ = unsealed.Add(firstLeaf)
+	_ = unsealed.Add(secondLeaf)
+	assert.NilError(t, unsealed.UseHashChaining(true))
+	assert.NilError(t, unsealed.CheckIntegrity())
+	_ = unsealed.UseHashChaining(false)
+	_ = unsealed.Add(branch.Leaf{
+		ID:       thirdLeaf.ID,
+		Position: 150,
+		Size:     10,
+		Previous: secondLeaf.ID,
+	})
+	err = unsealed.UseHashChaining(true)
+	_, ok = err.(*exception.BrokenChainError)
+	assert.Assert(t, ok)
+	found, _ = unsealed.Search(firstLeaf.ID)
+	found.Size = 99
+	found.Digest = model.EmptyHash
+	err = unsealed.UseHashChaining(true)
+	_, ok = err.(*exception.BrokenChainError)
+	assert.Assert(t, ok)
+}
+
+// TestLinePage ...
+func TestLinePage(t *testing.T) {
+	treee, _ := index.New(101)
+	var ids model.Hashes
+	previous := model.EmptyHash
+	for i := 0; i < 7; i++ {
+		id := model.Hash(fmt.Sprintf("%064x", i+1))
+		_ = treee.Add(branch.Leaf{
+			ID:       id,
+			Position: int64(i * 10),
+			Size:     10,
+			Previous: previous,
+		})
+		ids = append(ids, id)
+		previous = id
+	}
+
+	page, next, err := treee.LinePage(ids[3], model.EmptyHash, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(page), 3)
+	assert.Equal(t, page[0].ID, ids[0])
+	assert.Equal(t, next, ids[2])
+	page, next, _ = treee.LinePage(ids[3], next, 3, false)
+	assert.Equal(t, page[0].ID, ids[3])
+	assert.Equal(t, next, ids[5])
+	page, next, _ = treee.LinePage(ids[3], next, 3, false)
+	assert.Equal(t, len(page), 1)
+	assert.Equal(t, page[0].ID, ids[6])
+	assert.Equal(t, next, model.EmptyHash)
+
+	page, next, _ = treee.LinePage(ids[0], model.EmptyHash, 4, true)
+	assert.Equal(t, len(page), 4)
+	assert.Equal(t, page[0].ID, ids[6])
+	assert.Equal(t, page[3].ID, ids[3])
+	page, next, _ = treee.LinePage(ids[0], next, 0, true)
+	assert.Equal(t, len(page), 3)
+	assert.Equal(t, page[2].ID, ids[0])
+	assert.Equal(t, next, model.EmptyHash)
+
+	_ = treee.Add(branch.Leaf{
+		ID:       model.Hash(fmt.Sprintf("%064x", 100)),
+		Position: 100,
+		Size:     10,
+	})
+	_, _, err = treee.LinePage(ids[0], model.Hash(fmt.Sprintf("%064x", 100)), 0, false)
+	_, ok := err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+}
+
+// TestChainLength ...
+func TestChainLength(t *testing.T) {
+	treee, _ := index.New(101)
+	var ids model.Hashes
+	previous := model.EmptyHash
+	for i := 0; i < 5; i++ {
+		id := model.Hash(fmt.Sprintf("%064x", i+1))
+		_ = treee.Add(branch.Leaf{
+			ID:       id,
+			Position: int64(i * 10),
+			Size:     10,
+			Previous: previous,
+		})
+		ids = append(ids, id)
+		previous = id
+	}
+	length, err := treee.ChainLength(ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, length, 5)
+	seq, _ := treee.IndexInChain(ids[3])
+	assert.Equal(t, seq, 3)
+	nth, _ := treee.Nth(ids[0], 4)
+	assert.Equal(t, nth.ID, ids[4])
+	_, err = treee.Nth(ids[0], 5)
+	_, ok := err.(*exception.OutOfRangeError)
+	assert.Assert(t, ok)
+
+	_ = treee.Remove(ids[1])
+	length, _ = treee.ChainLength(ids[0])
+	assert.Equal(t, length, 4)
+	seq, _ = treee.IndexInChain(ids[3])
+	assert.Equal(t, seq, 2)
+	nth, _ = treee.Nth(ids[4], 1)
+	assert.Equal(t, nth.ID, ids[2])
+
+	// Long subchain with many removals
+	previous = ids[4]
+	for i := 5; i < 1000; i++ {
+		id := model.Hash(fmt.Sprintf("%064x", i+1))
+		_ = treee.Add(branch.Leaf{ID: id, Position: int64(i * 10), Size: 10, Previous: previous})
+		previous = id
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 600; i++ {
+		_ = treee.Remove(model.Hash(fmt.Sprintf("%064x", r.Intn(999)+2)))
+	}
+	line, _ := treee.Line(ids[0])
+	length, _ = treee.ChainLength(ids[0])
+	assert.Equal(t, length, len(line))
+	for n, leaf := range line {
+		seq, err = treee.IndexInChain(leaf.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, seq, n)
+		nth, err = treee.Nth(ids[0], n)
+		assert.NilError(t, err)
+		assert.Equal(t, nth.ID, leaf.ID)
+	}
+}
+
+// TestNeighbours ...
+func TestNeighbours(t *testing.T) {
+	treee, _ := index.New(101)
+	var ids model.Hashes
+	previous := model.EmptyHash
+	for i := 0; i < 3; i++ {
+		id := model.Hash(fmt.Sprintf("%064x", i+1))
+		_ = treee.Add(branch.Leaf{
+			ID:       id,
+			Position: int64(i * 10),
+			Size:     10,
+			Previous: previous,
+		})
+		ids = append(ids, id)
+		previous = id
+	}
+	other := model.Hash(fmt.Sprintf("%064x", 100))
+	_ = treee.Add(branch.Leaf{
+		ID:       other,
+		Position: 100,
+		Size:     10,
+	})
+
+	next, err := treee.Next(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, next.ID, ids[1])
+	next, _ = treee.Next(ids[2])
+	assert.Assert(t, next == nil)
+	prev, _ := treee.Prev(ids[2])
+	assert.Equal(t, prev.ID, ids[1])
+	prev, _ = treee.Prev(ids[0])
+	assert.Assert(t, prev == nil, "the origin has no previous item")
+
+	same, _ := treee.SameChain(ids[0], ids[2])
+	assert.Assert(t, same)
+	same, _ = treee.SameChain(ids[0], other)
+	assert.Assert(t, !same)
+	distance, _ := treee.Distance(ids[2], ids[0])
+	assert.Equal(t, distance, -2)
+	_, err = treee.Distance(ids[0], other)
+	_, ok := err.(*exception.NotInSameChainError)
+	assert.Assert(t, ok)
+}
+
+// TestOrigins ...
+func TestOrigins(t *testing.T) {
+	treee, _ := index.New(101)
+	first := model.Hash(fmt.Sprintf("%064x", 1))
+	second := model.Hash(fmt.Sprintf("%064x", 2))
+	third := model.Hash(fmt.Sprintf("%064x", 3))
+	_ = treee.Add(branch.Leaf{ID: second, Position: 0, Size: 10})
+	_ = treee.Add(branch.Leaf{ID: first, Position: 10, Size: 10})
+	_ = treee.Add(branch.Leaf{ID: third, Position: 20, Size: 10, Previous: second})
+
+	origins := treee.Origins()
+	assert.Equal(t, len(origins), 2)
+	assert.Equal(t, origins[0].Origin, first)
+	assert.Equal(t, origins[0].Length, 1)
+	assert.Equal(t, origins[1].Origin, second)
+	assert.Equal(t, origins[1].Tail, third)
+	assert.Equal(t, origins[1].Length, 2)
+	assert.Equal(t, origins[1].TailPosition, int64(20))
+
+	// Pages sorted by length
+	for i := 4; i <= 10; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 11)), Position: 110, Size: 10, Previous: model.Hash(fmt.Sprintf("%064x", 5))})
+	page, next, err := treee.Chains(index.LENGTH_ORDER, "", 3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(page), 3)
+	assert.Equal(t, page[0].Origin, second)
+	assert.Equal(t, page[1].Origin, model.Hash(fmt.Sprintf("%064x", 5)))
+	assert.Equal(t, page[2].Origin, first)
+	// The cursor survives the removal of its subchain
+	_ = treee.Remove(first)
+	page, next, err = treee.Chains(index.LENGTH_ORDER, next, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, page[0].Origin, model.Hash(fmt.Sprintf("%064x", 4)))
+	page, next, _ = treee.Chains(index.LENGTH_ORDER, next, 3)
+	assert.Equal(t, len(page), 3)
+	assert.Equal(t, page[2].Origin, model.Hash(fmt.Sprintf("%064x", 10)))
+	assert.Equal(t, next, "")
+
+	recent, _, err := treee.Chains(index.RECENT_ORDER, "", 0)
+	assert.NilError(t, err)
+	assert.Equal(t, recent[0].Origin, model.Hash(fmt.Sprintf("%064x", 5)))
+	// A copy of the sorted list
+	recent[0].Origin = first
+	recent, _, _ = treee.Chains(index.RECENT_ORDER, "", 0)
+	assert.Equal(t, recent[0].Origin, model.Hash(fmt.Sprintf("%064x", 5)))
+	_, _, err = treee.Chains(index.RECENT_ORDER, "not a cursor", 0)
+	_, ok := err.(*exception.InvalidCursorError)
+	assert.Assert(t, ok)
+	_, _, err = treee.Chains("size", "", 0)
+	_, ok = err.(*exception.InvalidSortError)
+	assert.Assert(t, ok)
+}
+
+// TestWalk ...
+func TestWalk(t *testing.T) {
+	treee, _ := index.New(5)
+	for i := 0; i < 20; i++ {
+		_ = treee.Add(branch.Leaf{
+			ID:       model.Hash(fmt.Sprintf("%064x", i+1)),
+			Position: int64(i * 10),
+			Size:     10,
+		})
+	}
+
+	var walked model.Hashes
+	treee.Walk(func(leaf *branch.Leaf) bool {
+		walked = append(walked, leaf.ID)
+		return true
+	})
+	assert.Equal(t, len(walked), 20)
+
+	var iterated model.Hashes
+	for leaf := range treee.All() {
+		iterated = append(iterated, leaf.ID)
+		// Modifying the index while iterating doesn't deadlock
+		_ = treee.Remove(leaf.ID)
+	}
+	assert.Assert(t, walked.Equals(&iterated), "order should be stable")
+	assert.Equal(t, treee.Size(), uint64(0))
+
+	for _, id := range walked[:3] {
+		_ = treee.Add(branch.Leaf{ID: id, Position: 0, Size: 10})
+	}
+	count := 0
+	treee.Walk(func(leaf *branch.Leaf) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, count, 1)
+
+	// Over several pages
+	large, _ := index.New(101)
+	for i := 1; i <= 2500; i++ {
+		_ = large.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	all, _, _ := large.Scan("", 0)
+	walked = nil
+	large.Walk(func(leaf *branch.Leaf) bool {
+		walked = append(walked, leaf.ID)
+		return true
+	})
+	assert.Equal(t, len(walked), len(all))
+	for i, leaf := range all {
+		assert.Equal(t, walked[i], leaf.ID)
+	}
+}
+
+// TestScan ...
+func TestScan(t *testing.T) {
+	treee, _ := index.New(3)
+	for i := 0; i < 50; i++ {
+		_ = treee.Add(branch.Leaf{
+			ID:       model.Hash(fmt.Sprintf("%064x", i+1)),
+			Position: int64(i * 10),
+			Size:     10,
+		})
+	}
+	var walked model.Hashes
+	treee.Walk(func(leaf *branch.Leaf) bool {
+		walked = append(walked, leaf.ID)
+		return true
+	})
+
+	seen := make(map[model.Hash]int)
+	var scanned model.Hashes
+	cursor := ""
+	for i := 0; ; i++ {
+		leaves, next, err := treee.Scan(cursor, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, leaf := range leaves {
+			seen[leaf.ID]++
+			scanned = append(scanned, leaf.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+		// Concurrent inserts reshape the tree between pages
+		_ = treee.Add(branch.Leaf{
+			ID:       model.Hash(fmt.Sprintf("%064x", 1000+i)),
+			Position: int64(1000 + i),
+			Size:     1,
+		})
+	}
+	for _, id := range walked {
+		assert.Equal(t, seen[id], 1, "every leaf should be scanned exactly once")
+	}
+	for _, count := range seen {
+		assert.Equal(t, count, 1)
+	}
+	var original model.Hashes
+	for _, id := range scanned {
+		if walked.Contains(id) {
+			original = append(original, id)
+		}
+	}
+	assert.Assert(t, original.Equals(&walked), "scan should follow the walk order")
+
+	_, _, err := treee.Scan("not a cursor!", 10)
+	_, ok := err.(*exception.InvalidCursorError)
+	assert.Assert(t, ok)
+}
+
+// TestPositions ...
+func TestPositions(t *testing.T) {
+	treee, _ := index.New(101)
+	var ids model.Hashes
+	for i := 0; i < 10; i++ {
+		id := model.Hash(fmt.Sprintf("%064x", 10-i))
+		_ = treee.Add(branch.Leaf{
+			ID:       id,
+			Position: int64((9 - i) * 100),
+			Size:     100,
+		})
+		ids = append(model.Hashes{id}, ids...)
+	}
+
+	found, err := treee.AtPosition(0, 450)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, found.ID, ids[4])
+	_, err = treee.AtPosition(0, 1000)
+	_, ok := err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+
+	items := treee.PositionRange(0, 200, 500)
+	assert.Equal(t, len(items), 3)
+	assert.Equal(t, items[0].ID, ids[2])
+	assert.Equal(t, items[2].ID, ids[4])
+
+	_ = treee.Remove(ids[3])
+	items = treee.PositionRange(0, 200, 500)
+	assert.Equal(t, len(items), 2)
+	_, err = treee.AtPosition(0, 350)
+	assert.Assert(t, err != nil)
+
+	// Positions are relative to their segment
+	other := model.Hash(fmt.Sprintf("%064x", 11))
+	_ = treee.Add(branch.Leaf{ID: other, Segment: 1, Position: 250, Size: 100})
+	found, err = treee.AtPosition(1, 300)
+	assert.NilError(t, err)
+	assert.Equal(t, found.ID, other)
+	found, err = treee.AtPosition(0, 250)
+	assert.NilError(t, err)
+	assert.Equal(t, found.ID, ids[2])
+	assert.Equal(t, len(treee.PositionRange(0, 200, 500)), 2)
+	assert.Equal(t, len(treee.PositionRange(1, 200, 500)), 1)
+
+	// Each segment starts anew
+	report := treee.CheckLayout()
+	assert.Equal(t, report.IsCorrupted(), false)
+	assert.Equal(t, len(report.Gaps), 2)
+	assert.Equal(t, report.Gaps[1].Segment, 1)
+	assert.Equal(t, report.Gaps[1].To, int64(250))
+}
+
+// TestStrictLayout ...
+func TestStrictLayout(t *testing.T) {
+	treee, _ := index.New(101)
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 0, Size: 100})
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 2)), Position: 90, Size: 20})
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 3)), Position: 150, Size: 50})
+
+	report := treee.CheckLayout()
+	assert.Assert(t, report.IsCorrupted())
+	assert.Equal(t, len(report.Overlaps), 1)
+	assert.Equal(t, report.Overlaps[0].From, int64(90))
+	assert.Equal(t, report.Overlaps[0].To, int64(100))
+	assert.Equal(t, len(report.Gaps), 1)
+	assert.Equal(t, report.Gaps[0].From, int64(110))
+	assert.Equal(t, report.Gaps[0].To, int64(150))
+
+	treee.UseStrictLayout(true)
+	err := treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 4)), Position: 120, Size: 40})
+	_, ok := err.(*exception.OverlappingItemError)
+	assert.Assert(t, ok)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 5)), Position: 110, Size: 40})
+	assert.NilError(t, err)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 6)), Position: -10, Size: 5})
+	_, ok = err.(*exception.InvalidPositionError)
+	assert.Assert(t, ok)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 6)), Position: 300, Size: -5})
+	_, ok = err.(*exception.InvalidSizeError)
+	assert.Assert(t, ok)
+
+	// Covered by an earlier item around a smaller one
+	treee.UseStrictLayout(false)
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 7)), Position: 10, Size: 5})
+	treee.UseStrictLayout(true)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 8)), Position: 50, Size: 5})
+	_, ok = err.(*exception.OverlappingItemError)
+	assert.Assert(t, ok)
+	assert.ErrorContains(t, err, fmt.Sprintf("%064x", 1))
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 8)), Position: 200, Size: 5})
+	assert.NilError(t, err)
+
+	// Negative positions saved before they were rejected
+	s := store.NewMemory()
+	_ = s.Put(&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Segment: 0, Position: 0, Size: 100})
+	_ = s.Put(&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 2)), Segment: 1, Position: -10, Size: 20})
+	_ = s.Put(&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 3)), Segment: 1, Position: 5, Size: 10})
+	loaded, _ := index.FromStore(s, 101)
+	report = loaded.CheckLayout()
+	assert.Equal(t, len(report.Overlaps), 1)
+	assert.Equal(t, report.Overlaps[0].First, model.Hash(fmt.Sprintf("%064x", 2)))
+	assert.Equal(t, report.Overlaps[0].Segment, 1)
+}
+
+// TestReadItem ...
+func TestReadItem(t *testing.T) {
+	file := data.SingleFile(strings.NewReader("helloworld!!"))
+	treee, _ := index.New(101)
+	_ = treee.Add(branch.Leaf{ID: model.Hash("aa"), Position: 0, Size: 5})
+	_ = treee.Add(branch.Leaf{ID: model.Hash("bb"), Position: 5, Size: 7, Previous: model.Hash("aa")})
+
+	content, err := treee.ReadItem(model.Hash("bb"), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(content), "world!!")
+
+	_ = treee.Add(branch.Leaf{ID: model.Hash("cc"), Position: 10, Size: 5})
+	_, err = treee.ReadItem(model.Hash("cc"), file)
+	assert.Error(t, err, "unexpected EOF")
+
+	dir := t.TempDir()
+	_ = os.WriteFile(dir+string(os.PathSeparator)+"segment-1.bin", []byte("other"), 0644)
+	segments := data.NewSegments(dir + string(os.PathSeparator) + "segment-%d.bin")
+	defer segments.Close()
+	_ = treee.Add(branch.Leaf{ID: model.Hash("dd"), Segment: 1, Position: 0, Size: 5})
+	content, err = treee.ReadItem(model.Hash("dd"), segments)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "other")
+	_, err = treee.ReadItem(model.Hash("aa"), segments)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+// TestAudit ...
+func TestAudit(t *testing.T) {
+	items := []string{"first item", "second item", "third item"}
+	content := ""
+	treee, _ := index.New(101)
+	for i, item := range items {
+		sum := sha256.Sum256([]byte(item))
+		_ = treee.Add(branch.Leaf{
+			ID:       model.Hash(hex.EncodeToString(sum[:])),
+			Position: int64(len(content)),
+			Size:     int64(len(item)),
+		})
+		if i == 1 {
+			item = "tampered!!!"
+		}
+		content += item
+	}
+	file := data.SingleFile(strings.NewReader(content))
+	hasher, _ := data.NewHasher(data.SHA256)
+
+	mismatches := treee.Audit(file, hasher, 2)
+	assert.Equal(t, len(mismatches), 1)
+	sum := sha256.Sum256([]byte(items[1]))
+	assert.Equal(t, mismatches[0].ID, model.Hash(hex.EncodeToString(sum[:])))
+
+	treee.UseContentCheck(file, hasher)
+	sum = sha256.Sum256([]byte("first"))
+	err := treee.Add(branch.Leaf{ID: model.Hash(hex.EncodeToString(sum[:])), Position: 0, Size: 5})
+	assert.NilError(t, err)
+	err = treee.Add(branch.Leaf{ID: model.Hash("abcd"), Position: 0, Size: 5})
+	_, ok := err.(*exception.ContentMismatchError)
+	assert.Assert(t, ok)
+}
+
+// TestFollow ...
+func TestFollow(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := dir + string(os.PathSeparator) + "data.ndjson"
+	indexPath := dir + string(os.PathSeparator) + "treee.json"
+	first := `{"item":1}`
+	second := `{"item":2,"previous":"` + hashOf(first) + `"}`
+	err := os.WriteFile(dataPath, []byte(first+"\n"+`{"item":2`), 0644)
+	assert.NilError(t, err)
+
+	treee, _ := index.New(101)
+	follower, err := treee.Follow(dataPath, data.NDJSON, sha256.New, indexPath)
+	assert.NilError(t, err)
+	added, err := follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 1)
+	_, offset := follower.Offset()
+	assert.Equal(t, offset, int64(len(first)+1))
+
+	// The second record gets completed, the index and offset being saved at most every commit interval, and upon stopping
+	follower.UseCommitInterval(time.Hour)
+	f, _ := os.OpenFile(dataPath, os.O_WRONLY|os.O_TRUNC, 0644)
+	_, _ = f.WriteString(first + "\n" + second + "\n")
+	f.Close()
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 1)
+	saved, _ := os.ReadFile(indexPath + ".offset")
+	assert.Equal(t, string(saved), strconv.Itoa(len(first)+1))
+	follower.Stop()
+	line, err := treee.Line(model.Hash(hashOf(first)))
+	assert.NilError(t, err)
+	assert.Equal(t, len(line), 2)
+
+	// Upon restart, it resumes where it left off
+	reloaded, err := index.Load(indexPath)
+	assert.NilError(t, err)
+	assert.Equal(t, reloaded.Size(), uint64(2))
+	follower, err = reloaded.Follow(dataPath, data.NDJSON, sha256.New, indexPath)
+	assert.NilError(t, err)
+	defer follower.Stop()
+	_, offset = follower.Offset()
+	assert.Equal(t, offset, int64(len(first)+len(second)+2))
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 0)
+
+	// A record that can't be indexed is skipped instead of blocking the following ones
+	third := `{"item":3,"previous":"` + hashOf("unknown") + `"}`
+	fourth := `{"item":4}`
+	f, _ = os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.WriteString(third + "\n" + fourth + "\n")
+	f.Close()
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 1)
+	_, offset = follower.Offset()
+	assert.Equal(t, offset, int64(len(first)+len(second)+len(third)+len(fourth)+4))
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 0)
+	_, err = reloaded.Search(model.Hash(hashOf(fourth)))
+	assert.NilError(t, err)
+}
+
+// TestFollowSegments ...
+func TestFollowSegments(t *testing.T) {
+	dir := t.TempDir()
+	pattern := dir + string(os.PathSeparator) + "segment-%d.ndjson"
+	indexPath := dir + string(os.PathSeparator) + "treee.json"
+	_ = os.WriteFile(fmt.Sprintf(pattern, 0), []byte(`{"item":1}`+"\n"), 0644)
+
+	treee, _ := index.New(101)
+	follower, err := treee.Follow(pattern, data.NDJSON, sha256.New, indexPath)
+	assert.NilError(t, err)
+	added, err := follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 1)
+
+	// The storage rotates
+	_ = os.WriteFile(fmt.Sprintf(pattern, 1), []byte(`{"item":2}`+"\n"+`{"item":3}`+"\n"), 0644)
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 2)
+	segment, offset := follower.Offset()
+	assert.Equal(t, segment, 1)
+	assert.Equal(t, offset, int64(22))
+	follower.Stop()
+
+	found, err := treee.Search(model.Hash(hashOf(`{"item":3}`)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Segment, 1)
+	assert.Equal(t, found.Position, int64(11))
+
+	reloaded, _ := index.Load(indexPath)
+	follower, err = reloaded.Follow(pattern, data.NDJSON, sha256.New, indexPath)
+	assert.NilError(t, err)
+	defer follower.Stop()
+	segment, offset = follower.Offset()
+	assert.Equal(t, segment, 1)
+	assert.Equal(t, offset, int64(22))
+	found, err = reloaded.Search(model.Hash(hashOf(`{"item":3}`)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Segment, 1)
+
+	// The last record of a closed segment is indexed even without a trailing newline
+	f, _ := os.OpenFile(fmt.Sprintf(pattern, 1), os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.WriteString(`{"item":4}`)
+	f.Close()
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 0)
+	_ = os.WriteFile(fmt.Sprintf(pattern, 2), []byte(`{"item":5}`+"\n"), 0644)
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 2)
+	segment, offset = follower.Offset()
+	assert.Equal(t, segment, 2)
+	assert.Equal(t, offset, int64(11))
+	_, err = reloaded.Search(model.Hash(hashOf(`{"item":4}`)))
+	assert.NilError(t, err)
+}
+
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestCompact ...
+func TestCompact(t *testing.T) {
+	file := data.SingleFile(strings.NewReader("aaaa--bbbbccccdd"))
+	treee, _ := index.New(101)
+	_ = treee.Add(branch.Leaf{ID: model.Hash("aa"), Position: 0, Size: 4})
+	_ = treee.Add(branch.Leaf{ID: model.Hash("bb"), Position: 6, Size: 4})
+	_ = treee.Add(branch.Leaf{ID: model.Hash("cc"), Position: 10, Size: 4, Previous: model.Hash("aa")})
+	_ = treee.Add(branch.Leaf{ID: model.Hash("dd"), Position: 14, Size: 2})
+	_ = treee.Remove(model.Hash("dd"))
+
+	var compacted strings.Builder
+	relocations, err := treee.Compact(file, &compacted, index.CHAIN_ORDER, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, compacted.String(), "aaaaccccbbbb")
+	assert.Equal(t, len(relocations), 3)
+	assert.DeepEqual(t, relocations[2], index.Relocation{ID: model.Hash("bb"), From: 6, To: 8})
+
+	compacted.Reset()
+	relocations, err = treee.Compact(file, &compacted, index.FILE_ORDER, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, compacted.String(), "aaaabbbbcccc")
+	assert.NilError(t, treee.Relocate(relocations))
+	content, err := treee.ReadItem(model.Hash("cc"), data.SingleFile(strings.NewReader(compacted.String())))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "cccc")
+	found, _ := treee.AtPosition(0, 5)
+	assert.Equal(t, found.ID, model.Hash("bb"))
+
+	// Records keep their framing
+	framed := "aaaa\n\nbbbb\ncccc\n"
+	reframed, _ := index.New(101)
+	_ = reframed.Add(branch.Leaf{ID: model.Hash("bb"), Position: 6, Size: 4})
+	_ = reframed.Add(branch.Leaf{ID: model.Hash("cc"), Position: 11, Size: 4})
+	encoder, _ := data.NewEncoder(data.NDJSON)
+	compacted.Reset()
+	relocations, err = reframed.Compact(data.SingleFile(strings.NewReader(framed)), &compacted, index.FILE_ORDER, encoder)
+	assert.NilError(t, err)
+	assert.Equal(t, compacted.String(), "bbbb\ncccc\n")
+	assert.Equal(t, relocations[1].To, int64(5))
+	encoder, _ = data.NewEncoder(data.LENGTH_PREFIXED)
+	compacted.Reset()
+	relocations, err = reframed.Compact(data.SingleFile(strings.NewReader(framed)), &compacted, index.FILE_ORDER, encoder)
+	assert.NilError(t, err)
+	assert.Equal(t, compacted.String(), "\x00\x00\x00\x04bbbb\x00\x00\x00\x04cccc")
+	assert.DeepEqual(t, relocations[1], index.Relocation{ID: model.Hash("cc"), From: 11, To: 12})
+	decoder, _ := data.NewDecoder(data.LENGTH_PREFIXED, strings.NewReader(compacted.String()), 0, sha256.New)
+	record, err := decoder.Next()
+	assert.NilError(t, err)
+	assert.Equal(t, record.Position, int64(4))
+
+	// Relocations only apply once
+	err = treee.Relocate([]index.Relocation{{ID: model.Hash("bb"), From: 6, To: 0}})
+	_, ok := err.(*exception.StaleRelocationError)
+	assert.Assert(t, ok)
+
+	// An interrupted switchover is only finished once the pending index was written
+	dir := t.TempDir()
+	indexPath := dir + string(os.PathSeparator) + "treee.json"
+	dataPath := dir + string(os.PathSeparator) + "data"
+	_ = os.WriteFile(dataPath+index.PENDING_SUFFIX, []byte("new"), 0644)
+	done, err := index.FinishCompaction(indexPath, dataPath)
+	assert.NilError(t, err)
+	assert.Assert(t, !done)
+	_, err = os.Stat(dataPath + index.PENDING_SUFFIX)
+	assert.Assert(t, os.IsNotExist(err))
+
+	_ = os.WriteFile(dataPath+index.PENDING_SUFFIX, []byte("new"), 0644)
+	_, _ = treee.SaveAs(indexPath + index.PENDING_SUFFIX)
+	done, err = index.FinishCompaction(indexPath, dataPath)
+	assert.NilError(t, err)
+	assert.Assert(t, done)
+	switched, _ := os.ReadFile(dataPath)
+	assert.Equal(t, string(switched), "new")
+	reloaded, err := index.Load(indexPath)
+	assert.NilError(t, err)
+	found, _ = reloaded.Search(model.Hash("cc"))
+	assert.Equal(t, found.Position, int64(8))
+}
+
+// TestFilter ...
+func TestFilter(t *testing.T) {
+	treee, _ := index.New(101)
+	treee.UseFilter(0.01)
+	for i := 1; i <= 2000; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	for i := 1; i <= 2000; i++ {
+		_, err := treee.Search(model.Hash(fmt.Sprintf("%064x", i)))
+		assert.NilError(t, err)
+	}
+	_, err := treee.Search(model.Hash(fmt.Sprintf("%064x", 3000)))
+	_, ok := err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+
+	// Uppercase IDs are the same
+	found, err := treee.Search(model.Hash(fmt.Sprintf("%064X", 255)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Position, int64(2550))
+
+	_ = treee.Remove(model.Hash(fmt.Sprintf("%064x", 1)))
+	_, err = treee.Search(model.Hash(fmt.Sprintf("%064x", 1)))
+	_, ok = err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+
+	treee.UseFilter(0)
+	_, err = treee.Search(model.Hash(fmt.Sprintf("%064x", 2)))
+	assert.NilError(t, err)
+}
+
+func TestPaged(t *testing.T) {
+	path := t.TempDir() + string(os.PathSeparator) + "treee.pages"
+	treee, err := index.OpenPaged(path, 101, 50)
+	assert.NilError(t, err)
+	assert.Assert(t, treee.IsPaged())
+	for i := 1; i <= 1000; i++ {
+		item := branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10}
+		if i%10 != 1 {
+			item.Previous = model.Hash(fmt.Sprintf("%064x", i-1))
+		}
+		err = treee.Add(item)
+		assert.NilError(t, err)
+		if i%100 == 0 {
+			err = treee.Flush()
+			assert.NilError(t, err)
+		}
+	}
+	for i := 1; i <= 1000; i++ {
+		found, err := treee.Search(model.Hash(fmt.Sprintf("%064x", i)))
+		assert.NilError(t, err)
+		assert.Equal(t, found.Position, int64(i*10))
+	}
+	err = treee.Remove(model.Hash(fmt.Sprintf("%064x", 15)))
+	assert.NilError(t, err)
+	err = treee.Close()
+	assert.NilError(t, err)
+
+	reopened, err := index.OpenPaged(path, 0, 50)
+	assert.NilError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, reopened.InitPrime, uint64(101))
+	assert.Equal(t, reopened.Size(), uint64(999))
+	_, err = reopened.Search(model.Hash(fmt.Sprintf("%064x", 15)))
+	_, ok := err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+	subchain, err := reopened.Line(model.Hash(fmt.Sprintf("%064x", 13)))
+	assert.NilError(t, err)
+	assert.Equal(t, len(subchain), 9)
+	assert.Equal(t, subchain[len(subchain)-1].ID, model.Hash(fmt.Sprintf("%064x", 20)))
+	length, err := reopened.ChainLength(model.Hash(fmt.Sprintf("%064x", 13)))
+	assert.NilError(t, err)
+	assert.Equal(t, length, 9)
+	found, err := reopened.AtPosition(0, 5555)
+	assert.NilError(t, err)
+	assert.Equal(t, found.ID, model.Hash(fmt.Sprintf("%064x", 555)))
+
+	// Changes to evicted leaves are kept until flushed
+	err = reopened.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1001)), Position: 10010, Size: 10, Previous: model.Hash(fmt.Sprintf("%064x", 1000))})
+	assert.NilError(t, err)
+	for i := 1; i <= 1000; i += 7 {
+		_, _ = reopened.Search(model.Hash(fmt.Sprintf("%064x", i)))
+	}
+	last, err := reopened.Last(model.Hash(fmt.Sprintf("%064x", 991)))
+	assert.NilError(t, err)
+	assert.Equal(t, last.ID, model.Hash(fmt.Sprintf("%064x", 1001)))
+
+	// Obsolete records are reclaimed
+	info, _ := os.Stat(path)
+	err = reopened.CompactPages()
+	assert.NilError(t, err)
+	compacted, _ := os.Stat(path)
+	assert.Assert(t, compacted.Size() < info.Size())
+	found, err = reopened.AtPosition(0, 10015)
+	assert.NilError(t, err)
+	assert.Equal(t, found.ID, model.Hash(fmt.Sprintf("%064x", 1001)))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 1 + g; i <= 1000; i += 4 {
+				if i != 15 {
+					_, e := reopened.Search(model.Hash(fmt.Sprintf("%064x", i)))
+					assert.NilError(t, e)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	err = reopened.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1002)), Position: 10020, Size: 10})
+	assert.NilError(t, err)
+	assert.Assert(t, !reopened.CheckLayout().IsCorrupted())
+	err = reopened.Flush()
+	assert.NilError(t, err)
+	again, err := index.OpenPaged(path, 0, 50)
+	assert.NilError(t, err)
+	assert.Equal(t, again.Size(), uint64(1001))
+	found, err = again.Search(model.Hash(fmt.Sprintf("%064x", 500)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Position, int64(5000))
+	_ = again.Close()
+
+	// Migration of an in-memory index
+	inMemory, _ := index.New(13)
+	_ = inMemory.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 0, Size: 10})
+	_ = inMemory.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 14)), Position: 10, Size: 10})
+	migrated := t.TempDir() + string(os.PathSeparator) + "migrated.pages"
+	err = inMemory.SavePages(migrated)
+	assert.NilError(t, err)
+	paged, err := index.OpenPaged(migrated, 0, 1)
+	assert.NilError(t, err)
+	defer paged.Close()
+	assert.Equal(t, paged.InitPrime, uint64(13))
+	found, err = paged.Search(model.Hash(fmt.Sprintf("%064x", 14)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Position, int64(10))
+	assert.Equal(t, paged.Size(), uint64(2))
+	_, err = paged.Search(model.Hash(fmt.Sprintf("%064x", 1)))
+	assert.NilError(t, err)
+
+	// An unreadable branch fails the operations going through it rather than being taken for an empty one
+	inMemory, _ = index.New(13)
+	_ = inMemory.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 0, Size: 10})
+	_ = inMemory.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 2)), Position: 10, Size: 10})
+	corrupted := t.TempDir() + string(os.PathSeparator) + "corrupted.pages"
+	_ = inMemory.SavePages(corrupted)
+	content, _ := os.ReadFile(corrupted)
+	record := bytes.LastIndexByte(content[:bytes.Index(content, []byte(fmt.Sprintf("%064x", 1)))], '{')
+	content[record] = 'X'
+	_ = os.WriteFile(corrupted, content, 0644)
+	unreadable, err := index.OpenPaged(corrupted, 0, 1)
+	assert.NilError(t, err)
+	defer unreadable.Close()
+	_, err = unreadable.Search(model.Hash(fmt.Sprintf("%064x", 1)))
+	_, ok = err.(*exception.NotFoundError)
+	assert.Assert(t, err != nil && !ok)
+	err = unreadable.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 14)), Position: 20, Size: 10})
+	assert.Assert(t, err != nil)
+	assert.Equal(t, unreadable.Size(), uint64(2))
+	_, err = unreadable.Search(model.Hash(fmt.Sprintf("%064x", 2)))
+	assert.NilError(t, err)
+}
+
+func TestStore(t *testing.T) {
+	s := store.NewMemory()
+	treee, _ := index.New(13)
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 0, Size: 10})
+	err := treee.CopyTo(s)
+	assert.NilError(t, err)
+	treee.UseStore(s)
+	err = treee.UseHashChaining(true)
+	assert.NilError(t, err)
+	for i := 2; i <= 5; i++ {
+		err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10, Previous: model.Hash(fmt.Sprintf("%064x", i-1))})
+		assert.NilError(t, err)
+	}
+	err = treee.Remove(model.Hash(fmt.Sprintf("%064x", 3)))
+	assert.NilError(t, err)
+	assert.NilError(t, treee.SyncStore())
+
+	_, err = s.Get(model.Hash(fmt.Sprintf("%064x", 3)))
+	_, ok := err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+	stored, err := s.Get(model.Hash(fmt.Sprintf("%064x", 2)))
+	assert.NilError(t, err)
+	assert.Equal(t, stored.Next, model.Hash(fmt.Sprintf("%064x", 4)))
+
+	rebuilt, err := index.FromStore(s, 101)
+	assert.NilError(t, err)
+	assert.Equal(t, rebuilt.Size(), uint64(4))
+	subchain, err := rebuilt.Line(model.Hash(fmt.Sprintf("%064x", 5)))
+	assert.NilError(t, err)
+	assert.Equal(t, len(subchain), 4)
+	assert.NilError(t, rebuilt.UseHashChaining(true))
+	assert.NilError(t, rebuilt.CheckIntegrity())
+	length, err := rebuilt.ChainLength(model.Hash(fmt.Sprintf("%064x", 1)))
+	assert.NilError(t, err)
+	assert.Equal(t, length, 4)
+
+	// The store catches up with the index once it works again, without blocking it in the meantime
+	flaky := &failingStore{Store: store.NewMemory()}
+	flaky.setFailing(true)
+	treee, _ = index.New(13)
+	treee.UseStore(flaky)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 0, Size: 10})
+	assert.NilError(t, err)
+	assert.Error(t, treee.SyncStore(), "store unavailable")
+	_, err = treee.Search(model.Hash(fmt.Sprintf("%064x", 1)))
+	assert.NilError(t, err)
+	flaky.setFailing(false)
+	assert.NilError(t, treee.SyncStore())
+	_, err = flaky.Get(model.Hash(fmt.Sprintf("%064x", 1)))
+	assert.NilError(t, err)
+	flaky.setFailing(true)
+	err = treee.Remove(model.Hash(fmt.Sprintf("%064x", 1)))
+	assert.NilError(t, err)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 2)), Position: 10, Size: 10})
+	assert.NilError(t, err)
+	assert.Error(t, treee.SyncStore(), "store unavailable")
+	flaky.setFailing(false)
+	assert.NilError(t, treee.SyncStore())
+	_, err = flaky.Get(model.Hash(fmt.Sprintf("%064x", 1)))
+	_, ok = err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+	_, err = flaky.Get(model.Hash(fmt.Sprintf("%064x", 2)))
+	assert.NilError(t, err)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 0, Size: 10})
+	assert.NilError(t, err)
+	assert.NilError(t, treee.Close())
+	_, err = flaky.Get(model.Hash(fmt.Sprintf("%064x", 1)))
+	assert.NilError(t, err)
+
+	// Leaves sharing their first residues end up in nested nodes
+	large := store.NewMemory()
+	for i := 1; i <= 1000; i++ {
+		_ = large.Put(&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	rebuilt, err = index.FromStore(large, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, rebuilt.Size(), uint64(1000))
+	for i := 1; i <= 1000; i++ {
+		_, err = rebuilt.Search(model.Hash(fmt.Sprintf("%064x", i)))
+		assert.NilError(t, err)
+	}
+}
+
+// failingStore is a store whose writes fail on demand
+type failingStore struct {
+	store.Store
+	mu      sync.Mutex
+	failing bool
+}
+
+func (s *failingStore) setFailing(value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = value
+}
+
+func (s *failingStore) Put(leaves ...*branch.Leaf) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("store unavailable")
+	}
+	return s.Store.Put(leaves...)
+}
+
+func (s *failingStore) Delete(ids ...model.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("store unavailable")
+	}
+	return s.Store.Delete(ids...)
+}
+
+func TestCompression(t *testing.T) {
+	treee, _ := index.New(101)
+	for i := 1; i <= 500; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	err := treee.UseCompression("lzma")
+	assert.Error(t, err, "unsupported compression: lzma")
+
+	dir := t.TempDir()
+	plainPath := dir + string(os.PathSeparator) + "plain.json"
+	plain, err := treee.SaveAs(plainPath)
+	assert.NilError(t, err)
+	for algorithm, magic := range map[string][]byte{index.GZIP: {0x1f, 0x8b}, index.ZSTD: {0x28, 0xb5, 0x2f, 0xfd}} {
+		err = treee.UseCompression(algorithm)
+		assert.NilError(t, err)
+		path := dir + string(os.PathSeparator) + algorithm + ".json"
+		n, err := treee.SaveAs(path)
+		assert.NilError(t, err)
+		assert.Assert(t, n < plain/2)
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, len(content), n)
+		assert.Assert(t, strings.HasPrefix(string(content), string(magic)))
+
+		loaded, err := index.Load(path)
+		assert.NilError(t, err)
+		assert.Equal(t, loaded.Size(), uint64(500))
+		found, err := loaded.Search(model.Hash(fmt.Sprintf("%064x", 250)))
+		assert.NilError(t, err)
+		assert.Equal(t, found.Position, int64(2500))
+
+		// The compression of the loaded file is kept
+		_, err = loaded.SaveAs(path)
+		assert.NilError(t, err)
+		content, _ = os.ReadFile(path)
+		assert.Assert(t, strings.HasPrefix(string(content), string(magic)))
+	}
+	loaded, err := index.Load(plainPath)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(500))
+}
+
+func TestEncryption(t *testing.T) {
+	treee, _ := index.New(101)
+	for i := 1; i <= 500; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	key, err := index.ParseKey([]byte(strings.Repeat("ab", 32) + "\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(key), 32)
+	_, err = index.ParseKey([]byte("too short"))
+	assert.Assert(t, err != nil)
+	otherKey, _ := index.GenerateKey()
+
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	for _, compression := range []string{index.NO_COMPRESSION, index.GZIP} {
+		_ = treee.UseCompression(compression)
+		err = treee.UseEncryption(key)
+		assert.NilError(t, err)
+		_, err = treee.SaveAs(path)
+		assert.NilError(t, err)
+		content, _ := os.ReadFile(path)
+		assert.Assert(t, !strings.Contains(string(content), fmt.Sprintf("%064x", 1)))
+
+		_, err = index.Load(path)
+		_, ok := err.(*exception.WrongKeyError)
+		assert.Assert(t, ok)
+		_, err = index.LoadEncrypted(path, otherKey)
+		_, ok = err.(*exception.WrongKeyError)
+		assert.Assert(t, ok)
+		loaded, err := index.LoadEncrypted(path, key)
+		assert.NilError(t, err)
+		assert.Equal(t, loaded.Size(), uint64(500))
+
+		// Each file has its own subkey
+		_, err = treee.SaveAs(path)
+		assert.NilError(t, err)
+		resaved, _ := os.ReadFile(path)
+		assert.Assert(t, !bytes.Equal(resaved[:64], content[:64]))
+
+		// Altered or truncated
+		altered := append([]byte{}, content...)
+		altered[len(altered)/2] ^= 1
+		_ = os.WriteFile(path, altered, 0600)
+		_, err = index.LoadEncrypted(path, key)
+		assert.Assert(t, err != nil)
+		_ = os.WriteFile(path, content[:len(content)-100], 0600)
+		_, err = index.LoadEncrypted(path, key)
+		assert.Assert(t, err != nil)
+	}
+
+	// Unknown format version
+	_ = os.WriteFile(path, []byte("TREEENC1"+strings.Repeat("0", 100)), 0600)
+	_, err = index.LoadEncrypted(path, key)
+	assert.ErrorContains(t, err, "unsupported version of encrypted index")
+
+	// Key rotation
+	_, _ = treee.SaveAs(path)
+	loaded, _ := index.LoadEncrypted(path, key)
+	err = loaded.UseEncryption(otherKey)
+	assert.NilError(t, err)
+	_, err = loaded.SaveAs(path)
+	assert.NilError(t, err)
+	_, err = index.LoadEncrypted(path, key)
+	_, ok := err.(*exception.WrongKeyError)
+	assert.Assert(t, ok)
+	rotated, err := index.LoadEncrypted(path, otherKey)
+	assert.NilError(t, err)
+	found, err := rotated.Search(model.Hash(fmt.Sprintf("%064x", 250)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Position, int64(2500))
+
+	// A plain index loads whatever the key
+	_ = rotated.UseEncryption(nil)
+	_, _ = rotated.SaveAs(path)
+	_, err = index.LoadEncrypted(path, key)
+	assert.NilError(t, err)
+}
+
+// TestSignature ...
+func TestSignature(t *testing.T) {
+	treee, _ := index.New(101)
+	for i := 1; i <= 100; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+	}
+	public, private, err := index.GenerateSigningKey()
+	assert.NilError(t, err)
+	parsed, err := index.ParsePrivateKey([]byte(hex.EncodeToString(private.Seed()) + "\n"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, parsed, private)
+	otherPublic, otherPrivate, _ := index.GenerateSigningKey()
+	trusted, err := index.ParsePublicKeys([]byte("# ops\n" + hex.EncodeToString(otherPublic) + "\n\n" + hex.EncodeToString(public) + "\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(trusted), 2)
+
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	_, _ = treee.SaveAs(path)
+	err = index.VerifySignature(path, trusted)
+	_, ok := err.(*exception.InvalidSignatureError)
+	assert.Assert(t, ok)
+
+	treee.UseSigning(private)
+	_, err = treee.SaveAs(path)
+	assert.NilError(t, err)
+	err = index.VerifySignature(path, trusted)
+	assert.NilError(t, err)
+	err = index.VerifySignature(path, trusted[:1])
+	_, ok = err.(*exception.InvalidSignatureError)
+	assert.Assert(t, ok)
+
+	// Altered
+	content, _ := os.ReadFile(path)
+	altered := append([]byte{}, content...)
+	altered[len(altered)/2] ^= 1
+	_ = os.WriteFile(path, altered, 0600)
+	err = index.VerifySignature(path, trusted)
+	_, ok = err.(*exception.InvalidSignatureError)
+	assert.Assert(t, ok)
+
+	// Signed afterwards
+	_ = os.WriteFile(path, content, 0600)
+	err = index.SignFile(path, otherPrivate)
+	assert.NilError(t, err)
+	err = index.VerifySignature(path, trusted[:1])
+	assert.NilError(t, err)
+
+	// Verified while loading
+	loaded, err := index.LoadVerified(path, nil, trusted[:1])
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(100))
+	_ = os.WriteFile(path, altered, 0600)
+	loaded, err = index.LoadVerified(path, nil, trusted)
+	_, ok = err.(*exception.InvalidSignatureError)
+	assert.Assert(t, ok)
+	assert.Assert(t, loaded != nil)
+
+	// Concurrent saves leave a file matching its signature
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, e := treee.SaveAs(path)
+			assert.NilError(t, e)
+		}()
+	}
+	wg.Wait()
+	err = index.VerifySignature(path, trusted)
+	assert.NilError(t, err)
+
+	// Read-only
+	treee.UseReadOnly(true)
+	err = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 101)), Position: 1010, Size: 10})
+	_, ok = err.(*exception.ReadOnlyError)
+	assert.Assert(t, ok)
+	_, err = treee.SaveAs(path)
+	_, ok = err.(*exception.ReadOnlyError)
+	assert.Assert(t, ok)
+	assert.Equal(t, treee.Size(), uint64(100))
+}
+
+// TestGenerations ...
+func TestGenerations(t *testing.T) {
+	treee, _ := index.New(101)
+	dir := t.TempDir() + string(os.PathSeparator) + "snapshots"
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	err := treee.UseGenerations(dir, index.Retention{Last: 2}, 0)
+	assert.NilError(t, err)
+
+	var times []time.Time
+	for i := 1; i <= 4; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+		gen, err := treee.SaveGeneration(path)
+		assert.NilError(t, err)
+		assert.Equal(t, gen.Leaves, uint64(i))
+		times = append(times, gen.Time)
+		time.Sleep(2 * time.Millisecond)
+	}
+	all, err := index.Generations(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(all), 2)
+	assert.Equal(t, all[0].Leaves, uint64(3))
+	assert.Equal(t, all[1].Leaves, uint64(4))
+	info, _ := os.Stat(dir + string(os.PathSeparator) + all[1].File)
+	assert.Equal(t, info.Size(), all[1].Bytes)
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, len(entries), 3) // With the manifest
+	loaded, err := index.Load(path)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(4))
+
+	// Point-in-time restore
+	_ = os.WriteFile(path+".offset", []byte("0 40"), 0600)
+	gen, err := index.RestoreGeneration(dir, times[2].Add(time.Millisecond), path)
+	assert.NilError(t, err)
+	assert.Equal(t, gen.Leaves, uint64(3))
+	loaded, _ = index.Load(path)
+	assert.Equal(t, loaded.Size(), uint64(3))
+	_, err = os.Stat(path + ".offset")
+	assert.Assert(t, os.IsNotExist(err))
+	_, err = index.GenerationAt(dir, times[1])
+	_, ok := err.(*exception.NoGenerationError)
+	assert.Assert(t, ok)
+
+	// Retention policy
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	var history []index.Generation
+	for h := 0; h < 72; h++ {
+		for m := 0; m < 60; m += 20 {
+			history = append(history, index.Generation{Time: day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)})
+		}
+	}
+	kept := index.Retention{Last: 3, Hourly: 5, Daily: 2}.Keep(history)
+	assert.Equal(t, len(kept), 3+4+1) // The latest hour and day being already kept
+	assert.Equal(t, kept[0].Time, history[len(history)-1].Time)
+	assert.Equal(t, kept[len(kept)-1].Time, day.Add(47*time.Hour+40*time.Minute))
+	assert.Equal(t, len(index.Retention{}.Keep(history)), index.DEFAULT_GENERATIONS)
+	assert.Equal(t, len(index.Retention{Hourly: 1}.Keep(history)), 1)
+
+	// Minimum interval between generations
+	treee, _ = index.New(101)
+	dir = t.TempDir()
+	path = t.TempDir() + string(os.PathSeparator) + "treee.json"
+	err = treee.UseGenerations(dir, index.Retention{}, time.Hour)
+	assert.NilError(t, err)
+	treee.UseDeltas(1)
+	for i := 1; i <= 4; i++ {
+		_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10})
+		_, err = treee.SaveDelta(path)
+		assert.NilError(t, err)
+	}
+	all, _ = index.Generations(dir)
+	assert.Equal(t, len(all), 1)
+	assert.Equal(t, all[0].Leaves, uint64(1))
+	loaded, err = index.Load(path)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(4))
+	first, _ := index.Load(dir + string(os.PathSeparator) + all[0].File)
+	assert.Equal(t, first.Size(), uint64(1))
+
+	// The follower resumes from the offset saved along with the restored generation
+	treee, _ = index.New(101)
+	dir = t.TempDir()
+	path = dir + string(os.PathSeparator) + "treee.json"
+	dataPath := dir + string(os.PathSeparator) + "data.ndjson"
+	records := []string{`{"item":1}`, `{"item":2}`, `{"item":3}`}
+	_ = os.WriteFile(dataPath, []byte(records[0]+"\n"+records[1]+"\n"), 0644)
+	err = treee.UseGenerations(dir+string(os.PathSeparator)+"snapshots", index.Retention{}, 0)
+	assert.NilError(t, err)
+	follower, err := treee.Follow(dataPath, data.NDJSON, sha256.New, path)
+	assert.NilError(t, err)
+	added, err := follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 2)
+	restoredAt := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	f, _ := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.WriteString(records[2] + "\n")
+	f.Close()
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 1)
+	follower.Stop()
+	gen, err = index.RestoreGeneration(dir+string(os.PathSeparator)+"snapshots", restoredAt, path)
+	assert.NilError(t, err)
+	assert.Equal(t, gen.Offset, strconv.Itoa(len(records[0])+len(records[1])+2))
+	saved, _ := os.ReadFile(path + ".offset")
+	assert.Equal(t, string(saved), gen.Offset)
+	// The data being rolled back to the same point in time
+	_ = os.Truncate(dataPath, int64(len(records[0])+len(records[1])+2))
+	loaded, err = index.Load(path)
+	assert.NilError(t, err)
+	follower, err = loaded.Follow(dataPath, data.NDJSON, sha256.New, path)
+	assert.NilError(t, err)
+	defer follower.Stop()
+	_, offset := follower.Offset()
+	assert.Equal(t, strconv.FormatInt(offset, 10), gen.Offset)
+	added, err = follower.Poll()
+	assert.NilError(t, err)
+	assert.Equal(t, added, 0)
+	assert.Equal(t, loaded.Size(), uint64(2))
+	_, err = loaded.Search(model.Hash(hashOf(records[2])))
+	_, ok = err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+}
+
+// TestDeltas ...
+func TestDeltas(t *testing.T) {
+	treee, _ := index.New(101)
+	path := t.TempDir() + string(os.PathSeparator) + "treee.json"
+	treee.UseDeltas(3)
+	leafAt := func(i int) branch.Leaf {
+		return branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", i)), Position: int64(i * 10), Size: 10}
+	}
+	for i := 1; i <= 100; i++ {
+		_ = treee.Add(leafAt(i))
+	}
+	full, err := treee.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 0)
+
+	// Only the changed leaves are written
+	_ = treee.Add(branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 101)), Position: 1010, Size: 10, Previous: model.Hash(fmt.Sprintf("%064x", 50))})
+	_ = treee.Remove(model.Hash(fmt.Sprintf("%064x", 2)))
+	n, err := treee.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Assert(t, n > 0 && n < full/10)
+	n, err = treee.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+	assert.Equal(t, len(index.DeltaPaths(path)), 1)
+	stale, _ := os.ReadFile(index.DeltaPaths(path)[0])
+
+	key, _ := index.GenerateKey()
+	_ = treee.UseEncryption(key)
+	_ = treee.UseCompression(index.GZIP)
+	_, private, _ := index.GenerateSigningKey()
+	treee.UseSigning(private)
+	_ = treee.Add(leafAt(102))
+	_, err = treee.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 2)
+
+	_, err = index.Load(path)
+	_, ok := err.(*exception.WrongKeyError)
+	assert.Assert(t, ok)
+	loaded, err := index.LoadEncrypted(path, key)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(101))
+	_, err = loaded.Search(model.Hash(fmt.Sprintf("%064x", 2)))
+	_, ok = err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+	last, err := loaded.Last(model.Hash(fmt.Sprintf("%064x", 50)))
+	assert.NilError(t, err)
+	assert.Equal(t, last.ID, model.Hash(fmt.Sprintf("%064x", 101)))
+
+	// A loaded index goes on with its deltas, a full snapshot being written every 3 of them
+	_ = loaded.UseEncryption(key)
+	loaded.UseDeltas(3)
+	_ = loaded.Add(leafAt(103))
+	_, err = loaded.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 3)
+	_ = loaded.Add(leafAt(104))
+	_, err = loaded.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 0)
+	reloaded, err := index.LoadEncrypted(path, key)
+	assert.NilError(t, err)
+	assert.Equal(t, reloaded.Size(), uint64(103))
+
+	// Deltas of a previous full snapshot are ignored
+	_ = os.WriteFile(path+index.DELTA_SUFFIX+"000001", stale, 0600)
+	reloaded, err = index.LoadEncrypted(path, key)
+	assert.NilError(t, err)
+	assert.Equal(t, reloaded.Size(), uint64(103))
+	_, err = reloaded.Search(model.Hash(fmt.Sprintf("%064x", 103)))
+	assert.NilError(t, err)
+
+	// Signed deltas
+	trusted := []ed25519.PublicKey{private.Public().(ed25519.PublicKey)}
+	_ = index.SignFile(path, private)
+	_ = reloaded.UseEncryption(key)
+	reloaded.UseSigning(private)
+	reloaded.UseDeltas(1)
+	_ = reloaded.Add(leafAt(105))
+	_, err = reloaded.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 1)
+	err = index.VerifySignature(path, trusted)
+	assert.NilError(t, err)
+	verified, err := index.LoadVerified(path, key, trusted)
+	assert.NilError(t, err)
+	assert.Equal(t, verified.Size(), uint64(104))
+	signature, _ := os.ReadFile(index.DeltaPaths(path)[0] + index.SIGNATURE_SUFFIX)
+	_ = os.Remove(index.DeltaPaths(path)[0] + index.SIGNATURE_SUFFIX)
+	verified, err = index.LoadVerified(path, key, trusted)
+	_, ok = err.(*exception.InvalidSignatureError)
+	assert.Assert(t, ok)
+	assert.Equal(t, verified.Size(), uint64(104))
+	_ = os.WriteFile(index.DeltaPaths(path)[0]+index.SIGNATURE_SUFFIX, signature, 0600)
+	content, _ := os.ReadFile(index.DeltaPaths(path)[0])
+	content[len(content)/2] ^= 1
+	_ = os.WriteFile(index.DeltaPaths(path)[0], content, 0600)
+	err = index.VerifySignature(path, trusted)
+	_, ok = err.(*exception.InvalidSignatureError)
+	assert.Assert(t, ok)
+
+	// A full rewrite removes the deltas, and those encrypted with a former key are skipped without being decrypted
+	treee, _ = index.New(101)
+	path = t.TempDir() + string(os.PathSeparator) + "treee.json"
+	_ = treee.UseEncryption(key)
+	treee.UseDeltas(3)
+	for i := 1; i <= 2; i++ {
+		_ = treee.Add(leafAt(i))
+		_, err = treee.SaveDelta(path)
+		assert.NilError(t, err)
+	}
+	former, _ := os.ReadFile(index.DeltaPaths(path)[0])
+	rekeyed, err := index.LoadEncrypted(path, key)
+	assert.NilError(t, err)
+	newKey, _ := index.GenerateKey()
+	_ = rekeyed.UseEncryption(newKey)
+	_, err = rekeyed.SaveAs(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 0)
+	_ = os.WriteFile(path+index.DELTA_SUFFIX+"000001", former, 0600)
+	loaded, err = index.LoadEncrypted(path, newKey)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Size(), uint64(2))
+
+	// The next delta of an index saved as a whole is a full snapshot
+	_ = os.Remove(path + index.DELTA_SUFFIX + "000001")
+	_, err = treee.SaveAs(path)
+	assert.NilError(t, err)
+	_ = treee.Add(leafAt(3))
+	_, err = treee.SaveDelta(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(index.DeltaPaths(path)), 0)
+}
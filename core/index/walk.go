@@ -0,0 +1,36 @@
+package index
+
+import (
+	"github.com/cyrildever/treee/core/index/branch"
+)
+
+// walkPageSize is the number of leaves `Walk()` copies at once
+const walkPageSize = 1000
+
+//--- METHODS
+
+// Walk calls the passed function on a copy of every leaf of the index until it returns `false`.
+//
+// The leaves are visited in the stable order of their residues at each stage of the tree, ie. in ascending order of
+// remainders from the trunk down. They are read by pages of `walkPageSize` through `Scan()`, the read lock being released
+// before calling the function on each page, so that it could take its time or even modify the index, and that a paged
+// index never holds the whole tree in memory; as with `Scan()`, leaves inserted during the walk are visited if and only if
+// they come after the current one.
+func (t *Treee) Walk(fn func(*branch.Leaf) bool) {
+	cursor := ""
+	for {
+		leaves, next, err := t.Scan(cursor, walkPageSize)
+		if err != nil {
+			return
+		}
+		for _, leaf := range leaves {
+			if !fn(leaf) {
+				return
+			}
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,16 @@
+package response
+
+//--- TYPES
+
+// LineItem ...
+type LineItem struct {
+	ID     string `json:"id"`
+	Digest string `json:"digest"`
+}
+
+// ChainInfo ...
+type ChainInfo struct {
+	Origin string `json:"origin"`
+	Length int    `json:"length"`
+	Index  int    `json:"index"`
+}
@@ -0,0 +1,9 @@
+package response
+
+//--- TYPES
+
+// Page ...
+type Page struct {
+	Items interface{} `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
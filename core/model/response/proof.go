@@ -0,0 +1,16 @@
+package response
+
+//--- TYPES
+
+// ProofError ...
+type ProofError struct {
+	Code  int    `json:"code"`
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// Root ...
+type Root struct {
+	Root string `json:"root"`
+	Size uint64 `json:"size"`
+}
@@ -0,0 +1,10 @@
+package response
+
+//--- TYPES
+
+// Relation ...
+type Relation struct {
+	SameChain bool   `json:"sameChain"`
+	Distance  int    `json:"distance"`
+	First     string `json:"first,omitempty"`
+}
@@ -9,14 +9,24 @@ func GetCodeFromError(err error) int {
 	switch err.(type) {
 	case *exception.AlreadyExistsInIndexError:
 		return 303
+	case *exception.BrokenChainError:
+		return 412
+	case *exception.ContentMismatchError:
+		return 412
 	case *exception.EmptyItemError:
 		return 400
 	case *exception.InvalidHashStringError:
 		return 400
+	case *exception.InvalidPositionError:
+		return 400
 	case *exception.LoopError:
 		return 500
 	case *exception.NotFoundError:
 		return 404
+	case *exception.OverlappingItemError:
+		return 412
+	case *exception.ReadOnlyError:
+		return 403
 	default:
 		return 500
 	}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+var leavesBucket = []byte("leaves")
+
+//--- TYPES
+
+// Bolt is a store writing the leaves as JSON to an embedded key-value file, each call to `Put()` or `Delete()` being a durable transaction
+type Bolt struct {
+	db *bolt.DB
+}
+
+// boltSnapshot is a read-only copy of a Bolt store in a temporary file, so that it doesn't hold a transaction open on the store itself
+// (which would block the writes having to grow the file)
+type boltSnapshot struct {
+	db   *bolt.DB
+	path string
+}
+
+//--- METHODS
+
+// Close ...
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// Delete ...
+func (b *Bolt) Delete(ids ...model.Hash) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leavesBucket)
+		for _, id := range ids {
+			k, err := key(id)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get ...
+func (b *Bolt) Get(id model.Hash) (leaf *branch.Leaf, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		leaf, err = get(tx, id)
+		return err
+	})
+	return
+}
+
+// Iterate ...
+func (b *Bolt) Iterate(fn func(*branch.Leaf) bool) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return iterateTx(tx, fn)
+	})
+}
+
+// Put ...
+func (b *Bolt) Put(leaves ...*branch.Leaf) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leavesBucket)
+		for _, leaf := range leaves {
+			k, err := key(leaf.ID)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(leaf)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put([]byte(k), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Snapshot ...
+func (b *Bolt) Snapshot() (Reader, error) {
+	f, err := os.CreateTemp(filepath.Dir(b.db.Path()), filepath.Base(b.db.Path())+".snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	err = b.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(f)
+		return err
+	})
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return &boltSnapshot{
+		db:   db,
+		path: path,
+	}, nil
+}
+
+// Close ...
+func (s *boltSnapshot) Close() error {
+	err := s.db.Close()
+	if e := os.Remove(s.path); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Get ...
+func (s *boltSnapshot) Get(id model.Hash) (leaf *branch.Leaf, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		leaf, err = get(tx, id)
+		return err
+	})
+	return
+}
+
+// Iterate ...
+func (s *boltSnapshot) Iterate(fn func(*branch.Leaf) bool) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return iterateTx(tx, fn)
+	})
+}
+
+//--- FUNCTIONS
+
+// OpenBolt returns the store in the file at the passed path, creating it if need be;
+// since the file is locked by the process, it waits for at most a second for another one to release it
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(leavesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{
+		db: db,
+	}, nil
+}
+
+func get(tx *bolt.Tx, id model.Hash) (*branch.Leaf, error) {
+	k, err := key(id)
+	if err != nil {
+		return nil, err
+	}
+	value := tx.Bucket(leavesBucket).Get([]byte(k))
+	if value == nil {
+		return nil, exception.NewNotFoundError(k)
+	}
+	leaf := branch.Leaf{}
+	if err = json.Unmarshal(value, &leaf); err != nil {
+		return nil, err
+	}
+	return &leaf, nil
+}
+
+func iterateTx(tx *bolt.Tx, fn func(*branch.Leaf) bool) error {
+	cursor := tx.Bucket(leavesBucket).Cursor()
+	for k, value := cursor.First(); k != nil; k, value = cursor.Next() {
+		leaf := branch.Leaf{}
+		if err := json.Unmarshal(value, &leaf); err != nil {
+			return err
+		}
+		if !fn(&leaf) {
+			return nil
+		}
+	}
+	return nil
+}
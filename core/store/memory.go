@@ -0,0 +1,115 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+//--- TYPES
+
+// Memory is a store keeping copies of the leaves in memory
+type Memory struct {
+	sync.RWMutex
+	leaves map[string]branch.Leaf
+}
+
+//--- METHODS
+
+// Close ...
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Delete ...
+func (m *Memory) Delete(ids ...model.Hash) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, id := range ids {
+		k, err := key(id)
+		if err != nil {
+			return err
+		}
+		delete(m.leaves, k)
+	}
+	return nil
+}
+
+// Get ...
+func (m *Memory) Get(id model.Hash) (*branch.Leaf, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	k, err := key(id)
+	if err != nil {
+		return nil, err
+	}
+	leaf, ok := m.leaves[k]
+	if !ok {
+		return nil, exception.NewNotFoundError(k)
+	}
+	return &leaf, nil
+}
+
+// Iterate ...
+func (m *Memory) Iterate(fn func(*branch.Leaf) bool) error {
+	snapshot, _ := m.Snapshot()
+	iterate(snapshot.(*Memory).leaves, fn)
+	return nil
+}
+
+// Put ...
+func (m *Memory) Put(leaves ...*branch.Leaf) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, leaf := range leaves {
+		k, err := key(leaf.ID)
+		if err != nil {
+			return err
+		}
+		m.leaves[k] = *leaf
+	}
+	return nil
+}
+
+// Snapshot ...
+func (m *Memory) Snapshot() (Reader, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	leaves := make(map[string]branch.Leaf, len(m.leaves))
+	for k, leaf := range m.leaves {
+		leaves[k] = leaf
+	}
+	return &Memory{
+		leaves: leaves,
+	}, nil
+}
+
+//--- FUNCTIONS
+
+// NewMemory ...
+func NewMemory() *Memory {
+	return &Memory{
+		leaves: make(map[string]branch.Leaf),
+	}
+}
+
+func iterate(leaves map[string]branch.Leaf, fn func(*branch.Leaf) bool) {
+	keys := make([]string, 0, len(leaves))
+	for k := range leaves {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		leaf := leaves[k]
+		if !fn(&leaf) {
+			return
+		}
+	}
+}
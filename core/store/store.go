@@ -0,0 +1,56 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+)
+
+const (
+	// BOLT is the embedded key-value store writing to a single file
+	BOLT = "bolt"
+	// MEMORY is the in-memory store, eg. for tests
+	MEMORY = "memory"
+)
+
+//--- TYPES
+
+// Reader gives access to the leaves of a store
+type Reader interface {
+	// Get returns the leaf with the passed ID, or a `NotFoundError`
+	Get(id model.Hash) (*branch.Leaf, error)
+	// Iterate calls the passed function on every leaf in ascending order of IDs until it returns `false`
+	Iterate(fn func(*branch.Leaf) bool) error
+	Close() error
+}
+
+// Store keeps the leaves of an index by ID so that the tree could be rebuilt from it, each change being written as it's made
+type Store interface {
+	Reader
+	// Put writes all the passed leaves at once, replacing existing ones with the same ID
+	Put(leaves ...*branch.Leaf) error
+	// Delete removes all the leaves with the passed IDs at once, ignoring unknown ones
+	Delete(ids ...model.Hash) error
+	// Snapshot returns a read-only view of the store as it is now, unaffected by later changes, that must be closed once done
+	Snapshot() (Reader, error)
+}
+
+//--- FUNCTIONS
+
+// Open returns the store of the passed kind (`BOLT` or `MEMORY`), the path only being used by those writing to a file
+func Open(kind, path string) (Store, error) {
+	switch kind {
+	case BOLT:
+		return OpenBolt(path)
+	case MEMORY:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown store: %s", kind)
+	}
+}
+
+// key returns the normalized ID of the passed leaf
+func key(id model.Hash) (string, error) {
+	return id.String()
+}
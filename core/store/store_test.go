@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/cyrildever/treee/core/exception"
+	"github.com/cyrildever/treee/core/index/branch"
+	"github.com/cyrildever/treee/core/model"
+	"github.com/cyrildever/treee/core/store"
+	"gotest.tools/assert"
+)
+
+// TestStores ...
+func TestStores(t *testing.T) {
+	path := t.TempDir() + string(os.PathSeparator) + "treee.db"
+	for _, kind := range []string{store.MEMORY, store.BOLT} {
+		s, err := store.Open(kind, path)
+		assert.NilError(t, err)
+		checkStore(t, s)
+		assert.NilError(t, s.Close())
+	}
+
+	// Bolt is durable
+	s, err := store.Open(store.BOLT, path)
+	assert.NilError(t, err)
+	defer s.Close()
+	found, err := s.Get(model.Hash(fmt.Sprintf("%064X", 3)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Position, int64(300))
+
+	_, err = store.Open("unknown", path)
+	assert.Error(t, err, "unknown store: unknown")
+}
+
+func checkStore(t *testing.T, s store.Store) {
+	err := s.Put(
+		&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 2)), Position: 200, Size: 10},
+		&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 1)), Position: 100, Size: 10},
+		&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 3)), Position: 300, Size: 10},
+	)
+	assert.NilError(t, err)
+	err = s.Put(&branch.Leaf{ID: model.Hash(fmt.Sprintf("%064x", 2)), Position: 250, Size: 10})
+	assert.NilError(t, err)
+
+	found, err := s.Get(model.Hash(fmt.Sprintf("%064x", 2)))
+	assert.NilError(t, err)
+	assert.Equal(t, found.Position, int64(250))
+
+	snapshot, err := s.Snapshot()
+	assert.NilError(t, err)
+	err = s.Delete(model.Hash(fmt.Sprintf("%064x", 1)), model.Hash(fmt.Sprintf("%064x", 4)))
+	assert.NilError(t, err)
+	_, err = s.Get(model.Hash(fmt.Sprintf("%064x", 1)))
+	_, ok := err.(*exception.NotFoundError)
+	assert.Assert(t, ok)
+
+	var positions []int64
+	err = snapshot.Iterate(func(leaf *branch.Leaf) bool {
+		positions = append(positions, leaf.Position)
+		return true
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, positions, []int64{100, 250, 300})
+	assert.NilError(t, snapshot.Close())
+
+	positions = nil
+	err = s.Iterate(func(leaf *branch.Leaf) bool {
+		positions = append(positions, leaf.Position)
+		return false
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, positions, []int64{250})
+}
@@ -3,12 +3,20 @@ package main
 import (
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cyrildever/treee/api"
+	"github.com/cyrildever/treee/cmd"
 	"github.com/cyrildever/treee/common/logger"
 	"github.com/cyrildever/treee/config"
+	"github.com/cyrildever/treee/core/backup"
+	"github.com/cyrildever/treee/core/data"
+	"github.com/cyrildever/treee/core/exception"
 	"github.com/cyrildever/treee/core/index"
+	"github.com/cyrildever/treee/core/store"
+	"github.com/cyrildever/treee/utils/s3"
 )
 
 /** Usage:
@@ -17,41 +25,282 @@ import (
  *	`$ ./treee -t.port 7001 -t.host localhost -t.init 101`
  *
  *	Stop it with Ctrl^c
+ *
+ *	Or to run a one-shot command, eg. to validate the layout of the items in the data file:
+ *	`$ ./treee layout-check -file saved/treee.json`
  */
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		name, args := os.Args[1], os.Args[2:]
+		os.Args = os.Args[:1] // Leave the command flags to the command itself
+		os.Exit(cmd.Run(name, args))
+	}
+
 	log := logger.Init("main", "application")
 	conf, err := config.InitConfig(false)
 	if err != nil {
 		panic(err)
 	}
 
-	treee, err := index.Load(conf.IndexPath)
+	indexPath := conf.IndexPath
+	if indexPath == "" {
+		indexPath = "saved" + string(os.PathSeparator) + "treee.json"
+	}
+
+	if conf.DataPath != "" && !data.IsPattern(conf.DataPath) {
+		if done, err := index.FinishCompaction(indexPath, conf.DataPath); err != nil {
+			log.Crit("Unable to finish interrupted compaction", "error", err)
+			return
+		} else if done {
+			log.Warn("Interrupted compaction finished")
+		}
+	}
+
+	key, err := cmd.LoadKey(conf)
+	if err != nil {
+		log.Crit("Unable to read encryption key", "error", err)
+		return
+	}
+
+	signingKey, err := cmd.LoadSigningKey(conf)
 	if err != nil {
-		log.Warn("Index doesn't exist, building one...", "error", err)
-		treee, err = index.New(conf.InitPrime)
+		log.Crit("Unable to read signing key", "error", err)
+		return
+	}
+	trusted, err := cmd.LoadTrustedKeys(conf)
+	if err != nil {
+		log.Crit("Unable to read trusted keys", "error", err)
+		return
+	}
+	readOnly := false
+
+	retention := index.Retention{Last: conf.KeepLast, Hourly: conf.KeepHourly, Daily: conf.KeepDaily}
+	var backups *backup.Backup
+	if conf.S3Bucket != "" {
+		client, err := s3.New(conf.S3Endpoint, conf.S3Region, conf.S3Bucket, conf.S3AccessKey, conf.S3SecretKey)
 		if err != nil {
-			log.Crit("Unable to instantiate new index", "error", err)
+			log.Crit("Unable to use object store", "error", err)
 			return
 		}
-		log.Info("Index created", "initPrime", treee.InitPrime)
+		backups = backup.New(client, conf.S3Prefix, retention)
+	}
+
+	if key != nil && (conf.PagesPath != "" || conf.Store != "") {
+		log.Warn("Encryption isn't supported for the page file or store, which is written in plain: only an index file gets encrypted")
+	}
+
+	var treee *index.Treee
+	if conf.PagesPath != "" {
+		treee, err = index.OpenPaged(conf.PagesPath, conf.InitPrime, conf.CacheSize)
+		if err != nil {
+			log.Crit("Unable to open paged index", "error", err)
+			return
+		}
+		indexPath = conf.PagesPath
+		log.Info("Paged index up and running", "size", treee.Size(), "initPrime", treee.InitPrime, "cache", conf.CacheSize)
+	} else if conf.Store != "" {
+		storePath := conf.StorePath
+		if storePath == "" {
+			storePath = "saved" + string(os.PathSeparator) + "treee.db"
+		}
+		treee, err = openStore(conf.Store, storePath, indexPath, key, conf.InitPrime)
+		if err != nil {
+			log.Crit("Unable to open store", "error", err)
+			return
+		}
+		indexPath = storePath
+		log.Info("Index rebuilt from store", "store", conf.Store, "size", treee.Size(), "initPrime", treee.InitPrime)
 	} else {
-		log.Info("Index up and running", "size", treee.Size(), "initPrime", treee.InitPrime)
+		if _, e := os.Stat(indexPath); os.IsNotExist(e) && conf.SnapshotDir != "" {
+			if gen, err := index.RestoreGeneration(conf.SnapshotDir, time.Now(), indexPath); err == nil {
+				log.Warn("Index file restored from latest snapshot generation", "file", gen.File, "time", gen.Time)
+			}
+		}
+		if _, e := os.Stat(indexPath); os.IsNotExist(e) && backups != nil {
+			gen, err := backups.Restore(indexPath)
+			if _, ok := err.(*exception.NoGenerationError); err != nil && !ok {
+				// Starting with an empty index would push it over the backups
+				log.Crit("Unable to restore index from object store", "error", err)
+				return
+			} else if err == nil {
+				log.Warn("Index file restored from object store", "key", gen.File, "time", gen.Time)
+			}
+		}
+		treee, err = index.LoadVerified(indexPath, key, trusted)
+		if _, ok := err.(*exception.InvalidSignatureError); ok && conf.Unverified == "readonly" {
+			log.Error("Starting read-only", "error", err)
+			readOnly = true
+			err = nil
+		} else if ok {
+			log.Crit("Refusing to start", "error", err)
+			return
+		} else if err == nil && trusted != nil {
+			log.Info("Index signature verified")
+		}
+		if err != nil && !os.IsNotExist(err) {
+			// Starting with an empty index would overwrite it at the next save
+			log.Crit("Unable to load index", "error", err)
+			return
+		} else if err != nil {
+			log.Warn("Index doesn't exist, building one...", "error", err)
+			treee, err = index.New(conf.InitPrime)
+			if err != nil {
+				log.Crit("Unable to instantiate new index", "error", err)
+				return
+			}
+			log.Info("Index created", "initPrime", treee.InitPrime)
+		} else {
+			log.Info("Index up and running", "size", treee.Size(), "initPrime", treee.InitPrime)
+		}
+		if conf.SnapshotDir != "" {
+			if err = treee.UseGenerations(conf.SnapshotDir, retention, conf.SnapshotEvery); err != nil {
+				log.Crit("Unable to use snapshot generations", "error", err)
+				return
+			}
+		}
+		if conf.Deltas > 0 {
+			treee.UseDeltas(conf.Deltas)
+		}
+	}
+
+	if conf.UseChaining {
+		if err = treee.UseHashChaining(true); err != nil {
+			log.Crit("Corrupted index", "error", err)
+			return
+		}
+		if err = treee.CheckIntegrity(); err != nil {
+			log.Crit("Corrupted index", "error", err)
+			return
+		}
+	}
+
+	treee.UseStrictLayout(conf.StrictLayout)
+
+	treee.UseReadOnly(readOnly)
+	if signingKey != nil {
+		treee.UseSigning(signingKey)
+	}
+
+	if key != nil {
+		if err = treee.UseEncryption(key); err != nil {
+			log.Crit("Unable to encrypt index", "error", err)
+			return
+		}
+	}
+
+	if conf.Compression != "" {
+		if err = treee.UseCompression(conf.Compression); err != nil {
+			log.Crit("Unable to compress index", "error", err)
+			return
+		}
+	}
+
+	if conf.FilterRate > 0 {
+		treee.UseFilter(conf.FilterRate)
+		log.Info("Bloom filter built", "falsePositiveRate", conf.FilterRate)
 	}
 
 	index.Current = treee
 
-	willGracefullyStopIndex()
+	var follower *index.Follower
+	if conf.DataPath != "" {
+		source, err := data.OpenSource(conf.DataPath)
+		if err != nil {
+			log.Crit("Unable to open data", "error", err)
+			return
+		}
+		data.Current = source
+		log.Info("Data opened", "path", conf.DataPath)
+
+		if conf.VerifyContent {
+			hasher, err := data.NewHasher(conf.HashAlgorithm)
+			if err != nil {
+				log.Crit("Unable to check content", "error", err)
+				return
+			}
+			treee.UseContentCheck(source, hasher)
+		}
+
+		if conf.Follow && readOnly {
+			log.Warn("Not following data file of a read-only index")
+		} else if conf.Follow {
+			hasher, err := data.NewHasher(conf.HashAlgorithm)
+			if err != nil {
+				log.Crit("Unable to follow data file", "error", err)
+				return
+			}
+			savedPath := ""
+			if conf.UsePersistence || treee.IsPaged() || conf.Store != "" {
+				savedPath = indexPath
+			}
+			follower, err = treee.Follow(conf.DataPath, conf.RecordDecoder, hasher, savedPath)
+			if err != nil {
+				log.Crit("Unable to follow data file", "error", err)
+				return
+			}
+			follower.UseCommitInterval(conf.CommitInterval)
+			follower.Start(conf.PollInterval)
+			segment, offset := follower.Offset()
+			log.Info("Following data", "path", conf.DataPath, "segment", segment, "offset", offset)
+		}
+	}
+
+	if backups != nil && (treee.IsPaged() || conf.Store != "") {
+		log.Warn("Only the index file gets backed up to the object store")
+	} else if backups != nil {
+		backups.Start(indexPath, conf.BackupInterval)
+		log.Info("Backing up index file", "bucket", conf.S3Bucket, "prefix", conf.S3Prefix, "interval", conf.BackupInterval)
+	}
+
+	willGracefullyStopIndex(treee, follower, backups)
 
 	api.InitHTTPServer(conf)
 }
 
+// openStore rebuilds the index from the passed store, which gets filled with the saved index file, if any, when empty
+func openStore(kind, storePath, indexPath string, key []byte, initPrime uint64) (*index.Treee, error) {
+	s, err := store.Open(kind, storePath)
+	if err != nil {
+		return nil, err
+	}
+	treee, err := index.FromStore(s, initPrime)
+	if err != nil {
+		return nil, err
+	}
+	if treee.Size() == 0 {
+		saved, e := index.LoadEncrypted(indexPath, key)
+		if e != nil && !os.IsNotExist(e) {
+			return nil, e
+		}
+		if e == nil {
+			if err = saved.CopyTo(s); err != nil {
+				return nil, err
+			}
+			treee = saved
+		}
+	}
+	treee.UseStore(s)
+	return treee, nil
+}
+
 // willGracefullyStopIndex ...
-func willGracefullyStopIndex() {
+func willGracefullyStopIndex(treee *index.Treee, follower *index.Follower, backups *backup.Backup) {
 	log := logger.Init("main", "terminating")
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
+		if follower != nil {
+			// Not to save the index while closing it
+			follower.Stop()
+		}
+		if backups != nil {
+			// Not to abandon an upload in progress
+			backups.Stop()
+		}
+		if err := treee.Close(); err != nil {
+			log.Error("Unable to close index", "error", err)
+		}
 		log.Info("Goodbye ~")
 		os.Exit(1)
 	}()
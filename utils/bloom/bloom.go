@@ -0,0 +1,88 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+//--- TYPES
+
+// Filter is a Bloom filter telling for sure whether a key was never added, or that it may have been with the configured false-positive rate
+// as long as no more keys than its capacity were added
+type Filter struct {
+	bits     []uint64
+	m        uint64
+	k        uint64
+	capacity uint64
+	count    uint64
+}
+
+//--- METHODS
+
+// Add ...
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// Capacity returns the number of keys the filter was sized for
+func (f *Filter) Capacity() uint64 {
+	return f.capacity
+}
+
+// Count returns the number of keys added so far
+func (f *Filter) Count() uint64 {
+	return f.count
+}
+
+// MayContain returns `false` if the passed key was never added
+func (f *Filter) MayContain(key []byte) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//--- FUNCTIONS
+
+// New returns an empty filter sized for the passed number of keys and false-positive rate (in ]0, 1[)
+func New(capacity uint64, falsePositiveRate float64) *Filter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// hashes returns the two hashes of the key used to derive the positions of its bits (Kirsch-Mitzenmacher double hashing)
+func hashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1 // Odd so that all positions get visited
+	return h1, h2
+}
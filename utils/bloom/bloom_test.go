@@ -0,0 +1,29 @@
+package bloom_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cyrildever/treee/utils/bloom"
+	"gotest.tools/assert"
+)
+
+// TestFilter ...
+func TestFilter(t *testing.T) {
+	filter := bloom.New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.Add([]byte(fmt.Sprintf("%064x", i)))
+	}
+	assert.Equal(t, filter.Count(), uint64(10000))
+	for i := 0; i < 10000; i++ {
+		assert.Assert(t, filter.MayContain([]byte(fmt.Sprintf("%064x", i))))
+	}
+
+	falsePositives := 0
+	for i := 10000; i < 110000; i++ {
+		if filter.MayContain([]byte(fmt.Sprintf("%064x", i))) {
+			falsePositives++
+		}
+	}
+	assert.Assert(t, falsePositives < 2000, "false-positive rate too high: %d / 100000", falsePositives)
+}
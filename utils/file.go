@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomically replaces the content of the passed file with what the passed function writes, so that a crash never leaves it truncated
+// or half-written
+func WriteAtomically(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteFileAtomically replaces the content of the passed file so that a crash never leaves it truncated or half-written
+func WriteFileAtomically(path string, content []byte) error {
+	return WriteAtomically(path, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// LinkAtomically replaces the passed file with a hard link to the source file, or with a copy of it if they're not on the same file system
+func LinkAtomically(source, path string) error {
+	tmp := path + ".link.tmp"
+	_ = os.Remove(tmp)
+	if err := os.Link(source, tmp); err == nil {
+		return os.Rename(tmp, path)
+	}
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return WriteAtomically(path, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+}
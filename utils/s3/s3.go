@@ -0,0 +1,484 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CHECKSUM_HEADER holds the SHA-256 hash of the whole object in hexadecimal, checked when it's read back
+	CHECKSUM_HEADER = "X-Amz-Meta-Sha256"
+
+	// DEFAULT_PART_SIZE is the size of the parts of a multipart upload, objects smaller than that being uploaded at once
+	DEFAULT_PART_SIZE = 8 << 20
+
+	// DEFAULT_REGION ...
+	DEFAULT_REGION = "us-east-1"
+
+	// MIN_PART_SIZE is the minimum size S3 accepts for every part of a multipart upload but the last one
+	MIN_PART_SIZE = 5 << 20
+)
+
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+//--- TYPES
+
+// Client is a minimal client of an S3-compatible object store, eg. AWS S3 or MinIO, signing its requests with AWS Signature Version 4
+// and addressing the bucket in the path of the endpoint
+type Client struct {
+	Endpoint   *url.URL
+	Region     string
+	Bucket     string
+	AccessKey  string
+	SecretKey  string
+	PartSize   int64        // Default to `DEFAULT_PART_SIZE`, AWS S3 refusing less than `MIN_PART_SIZE`
+	HTTPClient *http.Client // Default to `http.DefaultClient`
+}
+
+// Object describes an object of the bucket
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type initiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// verifier checks the SHA-256 hash of what's read once the end is reached
+type verifier struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+//--- METHODS
+
+// Delete removes the object with the passed key, if any
+func (c *Client) Delete(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Get returns the content of the object with the passed key, whose reading fails with a `ChecksumError` at the end if it doesn't match
+// the hash it was uploaded with by `Put()`, or its MD5 hash in its ETag if that's missing; an object with neither, eg. uploaded in parts
+// by another client, isn't returned
+func (c *Client) Get(key string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if expected := resp.Header.Get(CHECKSUM_HEADER); expected != "" {
+		return &verifier{body: resp.Body, hash: sha256.New(), expected: strings.ToLower(expected)}, nil
+	}
+	// The ETag of an object uploaded at once and not encrypted with a KMS key is the MD5 hash of its content
+	if etag := strings.ToLower(strings.Trim(resp.Header.Get("ETag"), `"`)); len(etag) == 2*md5.Size {
+		if _, e := hex.DecodeString(etag); e == nil {
+			return &verifier{body: resp.Body, hash: md5.New(), expected: etag}, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, NewMissingChecksumError(key)
+}
+
+// List returns all the objects whose key starts with the passed prefix, in the order of their keys
+func (c *Client) List(prefix string) (objects []Object, err error) {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, e := c.do(http.MethodGet, "", query, nil, nil)
+		if e != nil {
+			return nil, e
+		}
+		var result listResult
+		e = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if e != nil {
+			return nil, e
+		}
+		for _, content := range result.Contents {
+			objects = append(objects, Object{Key: content.Key, Size: content.Size, LastModified: content.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Put uploads the passed content under the passed key, in parts of `PartSize` if larger than that; the content is read twice, first
+// to compute the hash of the whole object checked by `Get()`, and every request carries the MD5 and SHA-256 hashes of its body for the store
+// to reject it if altered in transit
+func (c *Client) Put(key string, content io.ReadSeeker) error {
+	h := sha256.New()
+	size, err := io.Copy(h, content)
+	if err != nil {
+		return err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := http.Header{CHECKSUM_HEADER: {hex.EncodeToString(h.Sum(nil))}}
+
+	partSize := c.PartSize
+	if partSize <= 0 {
+		partSize = DEFAULT_PART_SIZE
+	}
+	if size <= partSize {
+		body := make([]byte, size)
+		if _, err = io.ReadFull(content, body); err != nil {
+			return err
+		}
+		resp, err := c.do(http.MethodPut, key, nil, header, body)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return err
+	}
+	var initiated initiateResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if err = c.uploadParts(key, initiated.UploadID, content, partSize); err != nil {
+		// Otherwise the store keeps the uploaded parts
+		if resp, e := c.do(http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil); e == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// Sign adds the headers of AWS Signature Version 4 to the passed request for the passed hexadecimal SHA-256 hash of its body,
+// every header already set being signed
+func (c *Client) Sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		if name == "Authorization" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := amzDate[:8] + "/" + c.region() + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, c.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// do sends the signed request for the passed object key, or the bucket itself if empty, returning an `Error` if the store doesn't succeed
+func (c *Client) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	path := strings.TrimSuffix(c.Endpoint.Path, "/") + "/" + c.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	u := *c.Endpoint
+	u.Path = path
+	u.RawPath = encodePath(path)
+	u.RawQuery = encodeQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+		digest := md5.Sum(body)
+		req.Header.Set("Content-Md5", base64.StdEncoding.EncodeToString(digest[:]))
+	}
+	c.Sign(req, payloadHash, time.Now())
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e errorResponse
+		content, _ := io.ReadAll(resp.Body)
+		_ = xml.Unmarshal(content, &e)
+		return nil, NewError(resp.StatusCode, e.Code, e.Message)
+	}
+	return resp, nil
+}
+
+func (c *Client) region() string {
+	if c.Region == "" {
+		return DEFAULT_REGION
+	}
+	return c.Region
+}
+
+func (c *Client) uploadParts(key, uploadID string, content io.Reader, partSize int64) error {
+	var parts []completePart
+	buf := make([]byte, partSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(content, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := c.do(http.MethodPut, key, query, nil, buf[:n])
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		parts = append(parts, completePart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		if n < len(buf) {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(completeUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The store may report a failure after having answered 200
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(answer, []byte("<Error>")) {
+		var e errorResponse
+		_ = xml.Unmarshal(answer, &e)
+		return NewError(resp.StatusCode, e.Code, e.Message)
+	}
+	return nil
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	n, err := v.body.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := hex.EncodeToString(v.hash.Sum(nil)); actual != v.expected {
+			return n, NewChecksumError(v.expected, actual)
+		}
+	}
+	return n, err
+}
+
+func (v *verifier) Close() error {
+	return v.body.Close()
+}
+
+//--- FUNCTIONS
+
+// New returns a client of the passed bucket at the passed endpoint, eg. `https://s3.eu-west-3.amazonaws.com` or `http://localhost:9000`
+func New(endpoint, region, bucket, accessKey, secretKey string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint: %s", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("missing bucket")
+	}
+	return &Client{
+		Endpoint:  u,
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}, nil
+}
+
+// encodePath escapes every character of the passed path but the unreserved ones and the slashes, as expected by AWS Signature Version 4
+func encodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = encode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// encodeQuery returns the canonical query string of AWS Signature Version 4, sorted by name
+func encodeQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, encode(name)+"="+encode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func encode(str string) string {
+	var sb strings.Builder
+	for _, b := range []byte(str) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || b == '-' || b == '.' || b == '_' || b == '~' {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+//--- ERRORS
+
+// ChecksumError ...
+type ChecksumError struct {
+	message string
+}
+
+func (e ChecksumError) Error() string {
+	return e.message
+}
+
+// NewChecksumError ...
+func NewChecksumError(expected, actual string) *ChecksumError {
+	return &ChecksumError{
+		message: fmt.Sprintf("checksum mismatch: expected %s, got %s", expected, actual),
+	}
+}
+
+// NewMissingChecksumError ...
+func NewMissingChecksumError(key string) *ChecksumError {
+	return &ChecksumError{
+		message: fmt.Sprintf("no checksum to verify object %s with", key),
+	}
+}
+
+// Error is returned when the object store doesn't succeed
+type Error struct {
+	StatusCode int
+	Code       string
+	message    string
+}
+
+func (e Error) Error() string {
+	return e.message
+}
+
+// NewError ...
+func NewError(statusCode int, code, message string) *Error {
+	return &Error{
+		StatusCode: statusCode,
+		Code:       code,
+		message:    fmt.Sprintf("object store error %d: %s %s", statusCode, code, message),
+	}
+}